@@ -0,0 +1,62 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Baseline marks every registered migration up to version as applied
+// without running it, see BaselineContext
+func (m *Migrator) Baseline(version string, force bool) error {
+	return m.BaselineContext(context.Background(), version, force)
+}
+
+// BaselineContext marks every registered migration up to version as applied
+// without running it, for databases whose schema was created by other
+// means. Migrations already recorded are left alone, so running it again
+// does nothing. It refuses to add rows to a migrations table that already
+// has some, unless force is set.
+func (m *Migrator) BaselineContext(ctx context.Context, version string, force bool) error {
+	if m.Migrations[version] == nil {
+		return fmt.Errorf("migration %s is not registered", version)
+	}
+
+	return m.withLock(ctx, func() error {
+		baseline := []*Migration{}
+		for _, v := range m.Versions {
+			if v <= version && !m.applied(v) {
+				baseline = append(baseline, m.Migrations[v])
+			}
+		}
+
+		if len(baseline) == 0 {
+			m.log().Info("Nothing to baseline", "version", version)
+			return nil
+		}
+
+		if len(m.history) > 0 && !force {
+			return fmt.Errorf("`%s` already has %d row(s), use force to baseline anyway", m.table(), len(m.history))
+		}
+
+		lastBatch, err := m.lastBatch(ctx)
+		if err != nil {
+			return err
+		}
+
+		tx, err := m.db.BeginTx(ctx, &sql.TxOptions{})
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for _, mg := range baseline {
+			if err := m.recordUp(ctx, tx, mg, lastBatch+1, 0); err != nil {
+				return err
+			}
+			m.log().Info("Baselined migration", "version", mg.Version)
+		}
+
+		return tx.Commit()
+	})
+}
@@ -0,0 +1,66 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBaseline(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		createTableMigration("20240102000000", "posts"),
+		createTableMigration("20240103000000", "tags"),
+	)
+
+	// The schema already exists
+	if _, err := m.db.Exec("CREATE TABLE users (id INTEGER); CREATE TABLE posts (id INTEGER);"); err != nil {
+		t.Fatalf("Unable to create tables: %s", err)
+	}
+
+	if err := m.Baseline("20240102000000", false); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	expected := []string{"20240101000000", "20240102000000"}
+	if got := appliedVersions(t, m.db); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected applied versions %v, got %v", expected, got)
+	}
+
+	// Running it again does nothing
+	if err := m.Baseline("20240102000000", false); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); len(got) != 3 {
+		t.Errorf("Expected 3 applied versions, got %v", got)
+	}
+}
+
+func TestBaselineRefusesNonEmptyTable(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		createTableMigration("20240102000000", "posts"),
+	)
+
+	if err := m.Up(1); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if err := m.Baseline("20240102000000", false); err == nil {
+		t.Error("Expected an error for a migrations table with rows")
+	}
+
+	if err := m.Baseline("20240102000000", true); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); len(got) != 2 {
+		t.Errorf("Expected 2 applied versions, got %v", got)
+	}
+
+	if err := m.Baseline("20240105000000", true); err == nil {
+		t.Error("Expected an error for an unregistered version")
+	}
+}
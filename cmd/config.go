@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/lemmego/migration"
+	"github.com/spf13/cobra"
+)
+
+// GetConnection returns the connection of the config file selected with
+// the "--connection" flag or the MIGRATE_CONNECTION env variable, or the
+// default one. The config file is given with the "--config" flag, or found
+// by migration.FindConfigFile. It returns nil if there is no config file,
+// if no connection is selected and the file has no default one, or if no
+// connection is selected and the database is given by the "--driver" or
+// "--dsn" flags or their env variables. It is only called for the settings
+// given neither by flag nor by env variable.
+func GetConnection(cmd *cobra.Command) (*migration.Connection, error) {
+	path, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = migration.FindConfigFile()
+	}
+
+	name, err := cmd.Flags().GetString("connection")
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = os.Getenv("MIGRATE_CONNECTION")
+	}
+
+	// The flags and env variables describe another database than the file,
+	// whose settings then don't apply
+	if name == "" && describesDatabase(cmd) {
+		return nil, nil
+	}
+
+	if path == "" {
+		if name != "" {
+			return nil, errors.New("connection " + name + " is selected but no config file was found")
+		}
+		return nil, nil
+	}
+
+	config, err := migration.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := GetEnvironment(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Connection(name, env)
+}
+
+// describesDatabase reports whether the database is given by the
+// "--driver" or "--dsn" flags, or by the DB_DRIVER, DATABASE_URL or
+// DB_DATABASE env variables
+func describesDatabase(cmd *cobra.Command) bool {
+	for _, name := range []string{"driver", "dsn"} {
+		if flag := cmd.Flags().Lookup(name); flag != nil && flag.Value.String() != "" {
+			return true
+		}
+	}
+
+	for _, name := range []string{"DB_DRIVER", "DATABASE_URL", "DB_DATABASE"} {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMigrationsDir returns the migrations directory from the MIGRATIONS_DIR
+// env variable or the config file, defaulting to
+// migration.DefaultMigrationsDir
+func GetMigrationsDir(cmd *cobra.Command) (string, error) {
+	if os.Getenv("MIGRATIONS_DIR") != "" {
+		return migration.MigrationsDir(), nil
+	}
+
+	conn, err := GetConnection(cmd)
+	if err != nil {
+		return "", err
+	}
+	if conn != nil && conn.MigrationsDir != "" {
+		return strings.TrimSuffix(conn.MigrationsDir, "/"), nil
+	}
+
+	return migration.DefaultMigrationsDir, nil
+}
+
+func init() {
+	// Add "--config" and "--connection" flags to every command
+	MigrateCmd.PersistentFlags().String("config", "", "Config file (default $MIGRATE_CONFIG, migrate.yaml, migrate.yml or migrate.toml)")
+	MigrateCmd.PersistentFlags().String("connection", "", "Connection of the config file to use (default $MIGRATE_CONNECTION)")
+}
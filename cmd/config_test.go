@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/lemmego/migration"
+	"github.com/spf13/cobra"
+)
+
+// newConfigTestCommand returns a command with the flags of the "migrate"
+// commands, parsed from args
+func newConfigTestCommand(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+
+	root := &cobra.Command{Use: "migrate"}
+	root.PersistentFlags().String("config", "", "")
+	root.PersistentFlags().String("connection", "", "")
+	cmd := &cobra.Command{Use: "status"}
+	addConnectionFlags(cmd)
+	root.AddCommand(cmd)
+
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatalf("Unable to parse flags: %s", err)
+	}
+	return cmd
+}
+
+// clearConfigEnv unsets the env variables read along with the config file
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+
+	for _, name := range []string{"MIGRATE_CONFIG", "MIGRATE_CONNECTION", "MIGRATIONS_DIR", "MIGRATIONS_TABLE", "MIGRATIONS_SCHEMA", "DB_DRIVER", "DATABASE_URL", "DB_DATABASE", "APP_ENV"} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestConnectionFlagsWinOverConfigFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	clearConfigEnv(t)
+
+	// Several connections and no default
+	config := `
+connections:
+  primary:
+    driver: postgres
+    dsn: postgres://app@localhost/app
+  analytics:
+    driver: mysql
+    dsn: root@tcp(localhost:3306)/analytics
+    table: analytics_migrations
+`
+	if err := os.WriteFile("migrate.yaml", []byte(config), 0o644); err != nil {
+		t.Fatalf("Unable to write config: %s", err)
+	}
+
+	cmd := newConfigTestCommand(t, "-d", "sqlite", "-u", "file:app.db")
+	if dir, err := GetMigrationsDir(cmd); err != nil || dir != migration.DefaultMigrationsDir {
+		t.Errorf("Expected migrations dir %s, got %q, %v", migration.DefaultMigrationsDir, dir, err)
+	}
+	if driver, err := GetDriver(cmd); err != nil || driver != "sqlite" {
+		t.Errorf("Expected driver sqlite, got %q, %v", driver, err)
+	}
+	if dsn, err := GetDSN(cmd, "sqlite"); err != nil || dsn != "file:app.db" {
+		t.Errorf("Expected DSN file:app.db, got %q, %v", dsn, err)
+	}
+	if table, err := GetTableName(cmd); err != nil || table != migration.DefaultTableName {
+		t.Errorf("Expected table %s, got %q, %v", migration.DefaultTableName, table, err)
+	}
+	if schema, err := GetSchema(cmd); err != nil || schema != "" {
+		t.Errorf("Expected no schema, got %q, %v", schema, err)
+	}
+
+	// A selected connection provides what the flags don't give
+	cmd = newConfigTestCommand(t, "--connection", "analytics")
+	if driver, err := GetDriver(cmd); err != nil || driver != migration.DriverMySQL {
+		t.Errorf("Expected driver mysql, got %q, %v", driver, err)
+	}
+	if table, err := GetTableName(cmd); err != nil || table != "analytics_migrations" {
+		t.Errorf("Expected table analytics_migrations, got %q, %v", table, err)
+	}
+
+	cmd = newConfigTestCommand(t, "--connection", "tenant")
+	if _, err := GetDriver(cmd); err == nil {
+		t.Errorf("Expected an unknown connection to fail")
+	}
+}
+
+func TestConfigDefaultIgnoredForOtherDatabase(t *testing.T) {
+	t.Chdir(t.TempDir())
+	clearConfigEnv(t)
+
+	config := `
+default: primary
+connections:
+  primary:
+    driver: postgres
+    dsn: postgres://app@localhost/app
+    table: app_migrations
+    schema: meta
+    migrations_dir: db/migrations/
+`
+	if err := os.WriteFile("migrate.yaml", []byte(config), 0o644); err != nil {
+		t.Fatalf("Unable to write config: %s", err)
+	}
+
+	cmd := newConfigTestCommand(t, "-d", "sqlite", "-u", "file:app.db")
+	if table, err := GetTableName(cmd); err != nil || table != migration.DefaultTableName {
+		t.Errorf("Expected table %s, got %q, %v", migration.DefaultTableName, table, err)
+	}
+	if schema, err := GetSchema(cmd); err != nil || schema != "" {
+		t.Errorf("Expected no schema, got %q, %v", schema, err)
+	}
+
+	t.Setenv("DATABASE_URL", "file:app.db")
+	cmd = newConfigTestCommand(t)
+	if table, err := GetTableName(cmd); err != nil || table != migration.DefaultTableName {
+		t.Errorf("Expected table %s, got %q, %v", migration.DefaultTableName, table, err)
+	}
+
+	// Selecting the connection applies its settings again
+	cmd = newConfigTestCommand(t, "--connection", "primary")
+	if schema, err := GetSchema(cmd); err != nil || schema != "meta" {
+		t.Errorf("Expected schema meta, got %q, %v", schema, err)
+	}
+	if dir, err := GetMigrationsDir(cmd); err != nil || dir != "db/migrations" {
+		t.Errorf("Expected migrations dir db/migrations, got %q, %v", dir, err)
+	}
+
+	t.Setenv("DATABASE_URL", "")
+	cmd = newConfigTestCommand(t)
+	if table, err := GetTableName(cmd); err != nil || table != "app_migrations" {
+		t.Errorf("Expected table app_migrations, got %q, %v", table, err)
+	}
+}
@@ -1,8 +1,15 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
 
 	"github.com/lemmego/migration"
 	"github.com/spf13/cobra"
@@ -22,13 +29,53 @@ var migrateCreateCmd = &cobra.Command{
 		// 	fmt.Println("Unable to read flag `name`", err.Error())
 		// 	return
 		// }
-		if err := migration.CreateMigration(name); err != nil {
+		noTx, err := cmd.Flags().GetBool("no-tx")
+		if err != nil {
+			fmt.Println("Unable to read flag `no-tx`", err.Error())
+			return
+		}
+
+		sqlFiles, err := cmd.Flags().GetBool("sql")
+		if err != nil {
+			fmt.Println("Unable to read flag `sql`", err.Error())
+			return
+		}
+
+		seeder, err := cmd.Flags().GetBool("seeder")
+		if err != nil {
+			fmt.Println("Unable to read flag `seeder`", err.Error())
+			return
+		}
+
+		migrationsDir, err := GetMigrationsDir(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		if seeder {
+			if err := migration.CreateSeeder(migration.SeedersDir(migrationsDir), name); err != nil {
+				fmt.Println("Unable to create seeder", err.Error())
+			}
+			return
+		}
+
+		create := migration.CreateMigration
+		if sqlFiles {
+			create = migration.CreateSQLMigration
+		} else if noTx {
+			create = migration.CreateNoTxMigration
+		}
+
+		if err := create(migrationsDir, name); err != nil {
 			fmt.Println("Unable to create migration", err.Error())
 			return
 		}
 	},
 }
 
+// GetDriver returns the driver from the "--driver" flag, the DB_DRIVER env
+// variable or the selected connection of the config file, in that order
 func GetDriver(cmd *cobra.Command) (string, error) {
 	driver, err := cmd.Flags().GetString("driver")
 	if err != nil {
@@ -39,6 +86,16 @@ func GetDriver(cmd *cobra.Command) (string, error) {
 		driver = os.Getenv("DB_DRIVER")
 	}
 
+	if driver == "" {
+		conn, err := GetConnection(cmd)
+		if err != nil {
+			return "", err
+		}
+		if conn != nil {
+			driver = conn.Driver
+		}
+	}
+
 	if driver == "" {
 		return "", fmt.Errorf("driver is required")
 	}
@@ -46,6 +103,9 @@ func GetDriver(cmd *cobra.Command) (string, error) {
 	return driver, nil
 }
 
+// GetDSN returns the DSN from the "--dsn" flag, the DATABASE_URL env
+// variable, the DB_* env variables or the selected connection of the
+// config file, in that order
 func GetDSN(cmd *cobra.Command, driver string) (string, error) {
 	dsnStr, err := cmd.Flags().GetString("dsn")
 	if err != nil {
@@ -56,6 +116,18 @@ func GetDSN(cmd *cobra.Command, driver string) (string, error) {
 		dsnStr = os.Getenv("DATABASE_URL")
 	}
 
+	// The DB_* env variables describe a database as soon as its name is set
+	if dsnStr == "" && os.Getenv("DB_DATABASE") == "" {
+		conn, err := GetConnection(cmd)
+		if err != nil {
+			return "", err
+		}
+		if conn != nil {
+			conn.Driver = driver
+			return conn.DataSourceName()
+		}
+	}
+
 	if dsnStr == "" {
 		ds := migration.DataSource{
 			Driver:   driver,
@@ -75,6 +147,238 @@ func GetDSN(cmd *cobra.Command, driver string) (string, error) {
 	return dsnStr, nil
 }
 
+// GetTableName returns the migrations table name from the "--table" flag,
+// the MIGRATIONS_TABLE env variable or the config file, defaulting to
+// migration.DefaultTableName
+func GetTableName(cmd *cobra.Command) (string, error) {
+	tableName, err := cmd.Flags().GetString("table")
+	if err != nil {
+		return "", err
+	}
+
+	if tableName == "" {
+		tableName = os.Getenv("MIGRATIONS_TABLE")
+	}
+
+	if tableName == "" {
+		conn, err := GetConnection(cmd)
+		if err != nil {
+			return "", err
+		}
+		if conn != nil {
+			tableName = conn.Table
+		}
+	}
+
+	if tableName == "" {
+		tableName = migration.DefaultTableName
+	}
+
+	return tableName, nil
+}
+
+// GetSchema returns the schema of the migrations table from the "--schema"
+// flag, the MIGRATIONS_SCHEMA env variable or the config file
+func GetSchema(cmd *cobra.Command) (string, error) {
+	schema, err := cmd.Flags().GetString("schema")
+	if err != nil {
+		return "", err
+	}
+
+	if schema == "" {
+		schema = os.Getenv("MIGRATIONS_SCHEMA")
+	}
+
+	if schema == "" {
+		conn, err := GetConnection(cmd)
+		if err != nil {
+			return "", err
+		}
+		if conn != nil {
+			schema = conn.Schema
+		}
+	}
+
+	return schema, nil
+}
+
+// commandContext returns a context that is cancelled on SIGINT or SIGTERM,
+// and once the duration given by the "--timeout" flag elapses, if set
+func commandContext(cmd *cobra.Command) (context.Context, context.CancelFunc, error) {
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parent := cmd.Context()
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	ctx, stop := signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+	if timeout <= 0 {
+		return ctx, stop, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}, nil
+}
+
+// isDir reports whether path is an existing directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// GetEnvironment returns the environment given with the "--env" flag, or
+// else the APP_ENV env variable
+func GetEnvironment(cmd *cobra.Command) (string, error) {
+	if cmd.Flags().Lookup("env") != nil {
+		env, err := cmd.Flags().GetString("env")
+		if err != nil {
+			return "", err
+		}
+		if env != "" {
+			return env, nil
+		}
+	}
+
+	return os.Getenv("APP_ENV"), nil
+}
+
+// initMigrator connects to the database described by the command's flags,
+// environment and config file, and initializes the migrator against it
+// with the given options applied last
+func initMigrator(cmd *cobra.Command, extra ...migration.Option) (*migration.Migrator, error) {
+	migrationsDir, err := GetMigrationsDir(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := GetDriver(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	dsnStr, err := GetDSN(cmd, driver)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := migration.NewDB(dsnStr, driver)
+	if err != nil {
+		return nil, err
+	}
+
+	// Plain SQL migrations live next to the Go ones
+	if isDir(migrationsDir) {
+		if err := migration.GetMigrator().AddSQLMigrationsDir(migrationsDir); err != nil {
+			return nil, fmt.Errorf("Unable to load SQL migrations: %w", err)
+		}
+	}
+
+	tableName, err := GetTableName(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := GetSchema(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []migration.Option{
+		migration.WithTableName(tableName),
+		migration.WithSchema(schema),
+		migration.WithMigrationsDir(migrationsDir),
+	}
+	if cmd.Flags().Lookup("lock-timeout") != nil {
+		lockTimeout, err := cmd.Flags().GetDuration("lock-timeout")
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, migration.WithLockTimeout(lockTimeout))
+	}
+
+	if cmd.Flags().Lookup("allow-out-of-order") != nil {
+		allowOutOfOrder, err := cmd.Flags().GetBool("allow-out-of-order")
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, migration.WithAllowOutOfOrder(allowOutOfOrder))
+	}
+
+	env, err := GetEnvironment(cmd)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, migration.WithEnvironment(env))
+
+	// A dry run must not change the database, not even the migrations table
+	if cmd.Flags().Lookup("dry-run") != nil {
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, migration.WithReadOnly(dryRun))
+	}
+
+	if cmd.Flags().Lookup("tx-mode") != nil {
+		txModeStr, err := cmd.Flags().GetString("tx-mode")
+		if err != nil {
+			return nil, err
+		}
+		txMode, err := migration.ParseTxMode(txModeStr)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, migration.WithTxMode(txMode))
+	}
+
+	migrator, err := migration.Init(db, driver, append(opts, extra...)...)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to fetch migrator: %w", err)
+	}
+
+	return migrator, nil
+}
+
+// writePlan prints the SQL returned by plan, or writes it to the file given
+// by the "--output" flag
+func writePlan(cmd *cobra.Command, plan func() ([]string, error)) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	statements, err := plan()
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		return migration.WritePlan(os.Stdout, statements)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := migration.WritePlan(f, statements); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Println("Dry run written to", output)
+	return nil
+}
+
 var migrateUpCmd = &cobra.Command{
 	Use:   "up",
 	Short: "run up migrations",
@@ -85,34 +389,39 @@ var migrateUpCmd = &cobra.Command{
 			return
 		}
 
-		driver, err := GetDriver(cmd)
+		migrator, err := initMigrator(cmd)
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
 
-		dsnStr, err := GetDSN(cmd, driver)
+		ctx, cancel, err := commandContext(cmd)
 		if err != nil {
-			fmt.Println(err)
+			fmt.Println("Unable to read flag `timeout`", err.Error())
 			return
 		}
-
-		db := migration.NewDB(dsnStr, driver)
-		if db == nil {
-			fmt.Println("Unable to connect to the database")
+		defer cancel()
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			err := writePlan(cmd, func() ([]string, error) {
+				return migrator.PlanContext(ctx, migration.DirectionUp, step)
+			})
+			if err != nil {
+				fmt.Println("Unable to plan `up` migrations", err.Error())
+			}
 			return
 		}
 
-		migrator, err := migration.Init(db, driver)
+		err = migrator.UpContext(ctx, step)
 		if err != nil {
-			fmt.Println("Unable to fetch migrator", err.Error())
+			fmt.Println("Unable to run `up` migrations", err.Error())
 			return
 		}
 
-		err = migrator.Up(step)
-		if err != nil {
-			fmt.Println("Unable to run `up` migrations", err.Error())
-			return
+		if seed, _ := cmd.Flags().GetBool("seed"); seed {
+			if err := migrator.SeedContext(ctx); err != nil {
+				fmt.Println("Unable to run seeders", err.Error())
+			}
 		}
 	},
 }
@@ -121,41 +430,366 @@ var migrateDownCmd = &cobra.Command{
 	Use:   "down",
 	Short: "run down migrations",
 	Run: func(cmd *cobra.Command, args []string) {
-		step, err := cmd.Flags().GetInt("step")
+		batches, err := cmd.Flags().GetInt("batches")
 		if err != nil {
-			fmt.Println("Unable to read flag `step`", err.Error())
+			fmt.Println("Unable to read flag `batches`", err.Error())
 			return
 		}
 
-		driver, err := GetDriver(cmd)
+		steps, err := cmd.Flags().GetInt("steps")
+		if err != nil {
+			fmt.Println("Unable to read flag `steps`", err.Error())
+			return
+		}
+
+		if batches > 0 && steps > 0 {
+			fmt.Println("Flags `batches` and `steps` can't be used together")
+			return
+		}
+
+		// The deprecated "--step" counts batches from zero
+		if cmd.Flags().Changed("step") && steps == 0 && batches == 0 {
+			step, err := cmd.Flags().GetInt("step")
+			if err != nil {
+				fmt.Println("Unable to read flag `step`", err.Error())
+				return
+			}
+			batches = step + 1
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if !dryRun && !confirmProduction(cmd, "This will revert migrations.") {
+			fmt.Println("Aborted")
+			return
+		}
+
+		migrator, err := initMigrator(cmd)
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
 
-		dsnStr, err := GetDSN(cmd, driver)
+		ctx, cancel, err := commandContext(cmd)
+		if err != nil {
+			fmt.Println("Unable to read flag `timeout`", err.Error())
+			return
+		}
+		defer cancel()
+
+		if dryRun {
+			err = writePlan(cmd, func() ([]string, error) {
+				if steps > 0 {
+					return migrator.PlanDownStepsContext(ctx, steps)
+				}
+				return migrator.PlanDownBatchesContext(ctx, batches)
+			})
+			if err != nil {
+				fmt.Println("Unable to plan `down` migrations", err.Error())
+			}
+			return
+		}
+
+		if steps > 0 {
+			err = migrator.DownStepsContext(ctx, steps)
+		} else {
+			err = migrator.DownBatchesContext(ctx, batches)
+		}
+		if err != nil {
+			fmt.Println("Unable to run `down` migrations", err.Error())
+			return
+		}
+	},
+}
+
+// runCommand returns the Run function of a command that initializes the
+// migrator and calls fn with a context honoring the "--timeout" flag
+func runCommand(action string, fn func(ctx context.Context, migrator *migration.Migrator) error) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		migrator, err := initMigrator(cmd)
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
 
-		db := migration.NewDB(dsnStr, driver)
-		if db == nil {
-			fmt.Println("Unable to connect to the database")
+		ctx, cancel, err := commandContext(cmd)
+		if err != nil {
+			fmt.Println("Unable to read flag `timeout`", err.Error())
+			return
+		}
+		defer cancel()
+
+		if err := fn(ctx, migrator); err != nil {
+			fmt.Println("Unable to "+action, err.Error())
+		}
+	}
+}
+
+// confirm asks the user a yes/no question on the terminal, unless the
+// "--force" flag is set
+func confirm(cmd *cobra.Command, question string) bool {
+	if force, _ := cmd.Flags().GetBool("force"); force {
+		return true
+	}
+
+	fmt.Print(question + " [y/N] ")
+	var answer string
+	fmt.Fscanln(cmd.InOrStdin(), &answer)
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// confirmProduction asks for confirmation before a destructive command runs
+// in production, unless the "--force" flag is set. It returns true right
+// away in other environments.
+func confirmProduction(cmd *cobra.Command, warning string) bool {
+	env, err := GetEnvironment(cmd)
+	if err != nil || !migration.IsProduction(env) {
+		return err == nil
+	}
+
+	return confirm(cmd, warning+" The environment is "+env+". Continue?")
+}
+
+var migrateGotoCmd = &cobra.Command{
+	Use:   "goto VERSION",
+	Short: "apply or revert migrations to land on the given version",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Migration version is required")
 			return
 		}
 
-		migrator, err := migration.Init(db, driver)
+		runCommand("migrate to "+args[0], func(ctx context.Context, migrator *migration.Migrator) error {
+			states, err := migrator.MigrationStatusContext(ctx)
+			if err != nil {
+				return err
+			}
+
+			reverts := slices.ContainsFunc(states, func(state migration.MigrationState) bool {
+				return state.Applied && state.Version > args[0]
+			})
+			if reverts && !confirmProduction(cmd, "This will revert the migrations newer than "+args[0]+".") {
+				fmt.Println("Aborted")
+				return nil
+			}
+
+			return migrator.ToContext(ctx, args[0])
+		})(cmd, args)
+	},
+}
+
+var migrateBaselineCmd = &cobra.Command{
+	Use:   "baseline",
+	Short: "mark every migration up to a version as applied without running them",
+	Run: func(cmd *cobra.Command, args []string) {
+		version, err := cmd.Flags().GetString("version")
 		if err != nil {
-			fmt.Println("Unable to fetch migrator", err.Error())
+			fmt.Println("Unable to read flag `version`", err.Error())
 			return
 		}
 
-		err = migrator.Down(step)
+		if version == "" {
+			fmt.Println("Flag `version` is required")
+			return
+		}
+
+		force, err := cmd.Flags().GetBool("force")
 		if err != nil {
-			fmt.Println("Unable to run `down` migrations", err.Error())
+			fmt.Println("Unable to read flag `force`", err.Error())
 			return
 		}
+
+		runCommand("baseline migrations", func(ctx context.Context, migrator *migration.Migrator) error {
+			return migrator.BaselineContext(ctx, version, force)
+		})(cmd, args)
+	},
+}
+
+var migrateForceCmd = &cobra.Command{
+	Use:   "force VERSION",
+	Short: "mark a migration as applied without running it",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Migration version is required")
+			return
+		}
+
+		runCommand("force migration "+args[0], func(ctx context.Context, migrator *migration.Migrator) error {
+			return migrator.ForceContext(ctx, args[0])
+		})(cmd, args)
+	},
+}
+
+var migrateUnapplyCmd = &cobra.Command{
+	Use:   "unapply VERSION",
+	Short: "remove the record of a migration without running its down migration",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Migration version is required")
+			return
+		}
+
+		runCommand("unapply migration "+args[0], func(ctx context.Context, migrator *migration.Migrator) error {
+			return migrator.UnapplyContext(ctx, args[0])
+		})(cmd, args)
+	},
+}
+
+var migrateRepairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "remove records of deleted migrations and update the checksums of edited ones",
+	Run: runCommand("repair the migrations table", func(ctx context.Context, migrator *migration.Migrator) error {
+		return migrator.RepairContext(ctx)
+	}),
+}
+
+var migrateResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "roll back every applied migration",
+	Run: func(cmd *cobra.Command, args []string) {
+		if !confirmProduction(cmd, "This will roll back every migration.") {
+			fmt.Println("Aborted")
+			return
+		}
+
+		runCommand("reset migrations", func(ctx context.Context, migrator *migration.Migrator) error {
+			return migrator.ResetContext(ctx)
+		})(cmd, args)
+	},
+}
+
+var migrateRefreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "roll back every applied migration and run them all again",
+	Run: func(cmd *cobra.Command, args []string) {
+		if !confirmProduction(cmd, "This will roll back every migration before running them again.") {
+			fmt.Println("Aborted")
+			return
+		}
+
+		runCommand("refresh migrations", func(ctx context.Context, migrator *migration.Migrator) error {
+			return migrator.RefreshContext(ctx)
+		})(cmd, args)
+	},
+}
+
+var migrateFreshCmd = &cobra.Command{
+	Use:   "fresh",
+	Short: "drop every table of the database and run all migrations from scratch",
+	Run: func(cmd *cobra.Command, args []string) {
+		question := "This will drop every table of the database. Continue?"
+		if env, _ := GetEnvironment(cmd); migration.IsProduction(env) {
+			question = "This will drop every table of the " + env + " database. Continue?"
+		}
+		if !confirm(cmd, question) {
+			fmt.Println("Aborted")
+			return
+		}
+
+		runCommand("run `fresh` migrations", func(ctx context.Context, migrator *migration.Migrator) error {
+			if err := migrator.FreshContext(ctx); err != nil {
+				return err
+			}
+
+			if seed, _ := cmd.Flags().GetBool("seed"); seed {
+				return migrator.SeedContext(ctx)
+			}
+			return nil
+		})(cmd, args)
+	},
+}
+
+var migrateSquashCmd = &cobra.Command{
+	Use:   "squash",
+	Short: "replace the migrations up to a version with a snapshot of the schema",
+	Run: func(cmd *cobra.Command, args []string) {
+		until, err := cmd.Flags().GetString("until")
+		if err != nil {
+			fmt.Println("Unable to read flag `until`", err.Error())
+			return
+		}
+
+		if until == "" {
+			fmt.Println("Flag `until` is required")
+			return
+		}
+
+		if !confirm(cmd, "This will remove the files of the migrations up to "+until+". Continue?") {
+			fmt.Println("Aborted")
+			return
+		}
+
+		runCommand("squash migrations", func(ctx context.Context, migrator *migration.Migrator) error {
+			return migrator.SquashContext(ctx, until)
+		})(cmd, args)
+	},
+}
+
+var migrateSchemaDumpCmd = &cobra.Command{
+	Use:   "schema:dump",
+	Short: "write the schema of the database and the applied migrations to a SQL file",
+	Run: func(cmd *cobra.Command, args []string) {
+		file, err := cmd.Flags().GetString("file")
+		if err != nil {
+			fmt.Println("Unable to read flag `file`", err.Error())
+			return
+		}
+
+		runCommand("dump schema", func(ctx context.Context, migrator *migration.Migrator) error {
+			if file == "" {
+				file = migrator.SchemaFile()
+			}
+
+			var dump bytes.Buffer
+			if err := migrator.DumpSchemaContext(ctx, &dump); err != nil {
+				return err
+			}
+
+			if err := os.WriteFile(file, dump.Bytes(), 0o644); err != nil {
+				return err
+			}
+			fmt.Println("Schema written to", file)
+			return nil
+		})(cmd, args)
+	},
+}
+
+var migrateSchemaLoadCmd = &cobra.Command{
+	Use:   "schema:load",
+	Short: "create the schema of a fresh database from a dump, then run the newer migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		file, err := cmd.Flags().GetString("file")
+		if err != nil {
+			fmt.Println("Unable to read flag `file`", err.Error())
+			return
+		}
+
+		runCommand("load schema", func(ctx context.Context, migrator *migration.Migrator) error {
+			if file == "" {
+				file = migrator.SchemaFile()
+			}
+
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			if err := migrator.LoadSchemaContext(ctx, f); err != nil {
+				return err
+			}
+			return migrator.UpContext(ctx, 0)
+		})(cmd, args)
+	},
+}
+
+var migrateSeedCmd = &cobra.Command{
+	Use:   "seed [name...]",
+	Short: "run the given seeders, or every seeder, along with their dependencies",
+	Run: func(cmd *cobra.Command, args []string) {
+		runCommand("run seeders", func(ctx context.Context, migrator *migration.Migrator) error {
+			return migrator.SeedContext(ctx, args...)
+		})(cmd, args)
 	},
 }
 
@@ -163,55 +797,183 @@ var migrateStatusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "display status of each migrations",
 	Run: func(cmd *cobra.Command, args []string) {
-		driver, err := GetDriver(cmd)
+		format, err := cmd.Flags().GetString("format")
 		if err != nil {
-			fmt.Println(err)
+			fmt.Println("Unable to read flag `format`", err.Error())
+			return
+		}
+
+		failOnPending, err := cmd.Flags().GetBool("fail-on-pending")
+		if err != nil {
+			fmt.Println("Unable to read flag `fail-on-pending`", err.Error())
 			return
 		}
 
-		dsnStr, err := GetDSN(cmd, driver)
+		migrator, err := initMigrator(cmd)
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
 
-		db := migration.NewDB(dsnStr, driver)
-		if db == nil {
-			fmt.Println("Unable to connect to the database")
+		states, err := migrator.MigrationStatus()
+		if err != nil {
+			fmt.Println("Unable to fetch migration status", err.Error())
+			return
+		}
+
+		if err := writeStatus(os.Stdout, format, states); err != nil {
+			fmt.Println("Unable to display migration status", err.Error())
 			return
 		}
-		migrator, err := migration.Init(db, driver)
+
+		if failOnPending {
+			for _, state := range states {
+				if !state.Applied && !state.Skipped {
+					os.Exit(1)
+				}
+			}
+		}
+	},
+}
+
+var migrateUnlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "release a stale migration lock left behind by another process",
+	Run: func(cmd *cobra.Command, args []string) {
+		// Upgrading the migrations table would wait for the stale lock
+		migrator, err := initMigrator(cmd, migration.WithReadOnly(true))
 		if err != nil {
-			fmt.Println("Unable to fetch migrator", err.Error())
+			fmt.Println(err)
 			return
 		}
 
-		if err := migrator.MigrationStatus(); err != nil {
-			fmt.Println("Unable to fetch migration status", err.Error())
+		if err := migrator.ForceUnlock(); err != nil {
+			fmt.Println("Unable to release the migration lock", err.Error())
 			return
 		}
+
+		fmt.Println("Migration lock released")
 	},
 }
 
+var migrateValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "check that applied migrations were not edited or removed since they ran",
+	Run: func(cmd *cobra.Command, args []string) {
+		migrator, err := initMigrator(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		if err := migrator.Validate(); err != nil {
+			var validationErr *migration.ValidationError
+			if !errors.As(err, &validationErr) {
+				fmt.Println("Unable to validate migrations", err.Error())
+				return
+			}
+
+			for _, issue := range validationErr.Issues {
+				fmt.Println(issue.String())
+			}
+			os.Exit(1)
+		}
+
+		fmt.Println("All applied migrations are valid")
+	},
+}
+
+// addConnectionFlags adds the flags selecting the database and the
+// migrations table to the given commands
+func addConnectionFlags(cmds ...*cobra.Command) {
+	for _, c := range cmds {
+		c.Flags().StringP("driver", "d", "", "Driver Name")
+		c.Flags().StringP("dsn", "u", "", "Data Source Name")
+		c.Flags().String("table", "", "Migrations table name (default \""+migration.DefaultTableName+"\")")
+		c.Flags().String("schema", "", "Schema of the migrations table")
+		c.Flags().String("env", "", "Environment to run in, such as \"dev\" or \"prod\" (default $APP_ENV)")
+	}
+}
+
+// addRunFlags adds the flags controlling how migrations run to the given commands
+func addRunFlags(cmds ...*cobra.Command) {
+	for _, c := range cmds {
+		c.Flags().Duration("timeout", 0, "Abort the run after this duration (e.g. 10m), 0 means no timeout")
+		c.Flags().Duration("lock-timeout", migration.DefaultLockTimeout, "How long to wait for a migration lock held by another process")
+		c.Flags().String("tx-mode", "single", "Transaction mode: \"single\" (all or nothing) or \"per-migration\"")
+	}
+}
+
+// addDryRunFlags adds the flags of a dry run to the given commands
+func addDryRunFlags(cmds ...*cobra.Command) {
+	for _, c := range cmds {
+		c.Flags().Bool("dry-run", false, "Print the SQL that would run without changing the database")
+		c.Flags().StringP("output", "o", "", "Write the SQL of a dry run to this .sql file instead of printing it")
+	}
+}
+
 func init() {
 	// Add "--name", "--driver" and "--dsn" flags to "create" command
 	migrateCreateCmd.Flags().StringP("name", "n", "", "Name for the migration")
 	migrateCreateCmd.Flags().StringP("driver", "d", "", "Driver Name")
 	migrateCreateCmd.Flags().StringP("dsn", "u", "", "Data Source Name")
+	migrateCreateCmd.Flags().Bool("no-tx", false, "Generate a migration that runs outside of a transaction")
+	migrateCreateCmd.Flags().Bool("sql", false, "Generate a pair of .up.sql and .down.sql files instead of a Go file")
+	migrateCreateCmd.Flags().Bool("seeder", false, "Generate a seeder file in SEEDERS_DIR instead of a migration")
 
-	// Add "--step", "--driver" and "--dsn" flags to "up" and "down" command
+	// Add "--step" flag to "up" and "down" command
 	migrateUpCmd.Flags().IntP("step", "s", 0, "Number of migrations to execute")
-	migrateUpCmd.Flags().StringP("driver", "d", "", "Data Source Name")
-	migrateUpCmd.Flags().StringP("dsn", "u", "", "Data Source Name")
+	migrateDownCmd.Flags().IntP("step", "s", 0, "Number of batches to revert in addition to the last one")
+	migrateDownCmd.Flags().MarkDeprecated("step", "use --batches or --steps instead")
+
+	// Add "--batches" and "--steps" flags to "down" command
+	migrateDownCmd.Flags().IntP("batches", "b", 0, "Number of batches to revert (default 1)")
+	migrateDownCmd.Flags().Int("steps", 0, "Number of migrations to revert, newest version first")
+	addRunFlags(migrateUpCmd, migrateDownCmd, migrateGotoCmd, migrateResetCmd, migrateRefreshCmd, migrateFreshCmd, migrateBaselineCmd,
+		migrateForceCmd, migrateUnapplyCmd, migrateRepairCmd, migrateSquashCmd, migrateSchemaDumpCmd, migrateSchemaLoadCmd, migrateSeedCmd)
+	addDryRunFlags(migrateUpCmd, migrateDownCmd)
+
+	// Add "--allow-out-of-order" flag to the commands applying migrations
+	for _, c := range []*cobra.Command{migrateUpCmd, migrateGotoCmd} {
+		c.Flags().Bool("allow-out-of-order", false, "Apply pending migrations older than the latest applied one")
+	}
+
+	// Add "--force" flag to "fresh" command
+	migrateFreshCmd.Flags().BoolP("force", "f", false, "Drop the tables without asking for confirmation")
+
+	// Add "--version" and "--force" flags to "baseline" command
+	migrateBaselineCmd.Flags().String("version", "", "Last version to mark as applied")
+	migrateBaselineCmd.Flags().BoolP("force", "f", false, "Baseline even if the migrations table already has rows")
+
+	// Add "--seed" flag to "up" and "fresh" commands
+	migrateUpCmd.Flags().Bool("seed", false, "Run the seeders after migrating")
+	migrateFreshCmd.Flags().Bool("seed", false, "Run the seeders after migrating")
+
+	// Add "--force" flag to the commands asking for confirmation in production
+	for _, c := range []*cobra.Command{migrateDownCmd, migrateGotoCmd, migrateResetCmd, migrateRefreshCmd} {
+		c.Flags().BoolP("force", "f", false, "Don't ask for confirmation in production")
+	}
+
+	// Add "--until" and "--force" flags to "squash" command
+	migrateSquashCmd.Flags().String("until", "", "Last version to squash, the database must be migrated to it")
+	migrateSquashCmd.Flags().BoolP("force", "f", false, "Remove the squashed files without asking for confirmation")
+
+	// Add "--file" flag to "schema:dump" and "schema:load" commands
+	for _, c := range []*cobra.Command{migrateSchemaDumpCmd, migrateSchemaLoadCmd} {
+		c.Flags().String("file", "", "Path of the schema dump (default schema.sql in the migrations directory)")
+	}
 
-	migrateDownCmd.Flags().IntP("step", "s", 0, "Number of migrations to execute")
-	migrateDownCmd.Flags().StringP("driver", "d", "", "Driver Name")
-	migrateDownCmd.Flags().StringP("dsn", "u", "", "Data Source Name")
+	// Add "--format" and "--fail-on-pending" flags to "status" command
+	migrateStatusCmd.Flags().String("format", "table", "Output format: \"table\", \"json\" or \"yaml\"")
+	migrateStatusCmd.Flags().Bool("fail-on-pending", false, "Exit with status 1 when some migrations are pending")
 
-	// Add "--driver" and "--dsn" flags to "status" command
-	migrateStatusCmd.Flags().StringP("driver", "d", "", "Driver Name")
-	migrateStatusCmd.Flags().StringP("dsn", "u", "", "Data Source Name")
+	addConnectionFlags(migrateUpCmd, migrateDownCmd, migrateStatusCmd, migrateUnlockCmd, migrateValidateCmd,
+		migrateGotoCmd, migrateResetCmd, migrateRefreshCmd, migrateFreshCmd, migrateBaselineCmd, migrateForceCmd, migrateUnapplyCmd, migrateRepairCmd,
+		migrateSquashCmd, migrateSchemaDumpCmd, migrateSchemaLoadCmd, migrateSeedCmd)
 
-	// Add "create", "status", "up" and "down" commands to the "migrate" command
-	MigrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateCreateCmd, migrateStatusCmd)
+	// Add "create", "status", "up", "down", "goto", "reset", "refresh", "fresh", "baseline", "force", "unapply", "repair", "squash",
+	// "schema:dump", "schema:load", "seed", "unlock" and "validate" commands to the "migrate" command
+	MigrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateCreateCmd, migrateStatusCmd, migrateGotoCmd, migrateResetCmd, migrateRefreshCmd,
+		migrateFreshCmd, migrateBaselineCmd, migrateForceCmd, migrateUnapplyCmd, migrateRepairCmd, migrateSquashCmd, migrateSchemaDumpCmd,
+		migrateSchemaLoadCmd, migrateSeedCmd, migrateUnlockCmd, migrateValidateCmd)
 }
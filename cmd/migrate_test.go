@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lemmego/migration"
+	"github.com/spf13/pflag"
+)
+
+var registerOnce sync.Once
+
+// newCommandTestDB registers migrations creating the users and posts
+// tables on the default migrator, and returns the path of a SQLite
+// database to run the commands against
+func newCommandTestDB(t *testing.T) string {
+	t.Helper()
+
+	registerOnce.Do(func() {
+		for version, table := range map[string]string{"20240101000000": "users", "20240102000000": "posts"} {
+			migration.GetMigrator().AddMigration(&migration.Migration{
+				Version: version,
+				Up: func(tx *sql.Tx) error {
+					_, err := tx.Exec("CREATE TABLE " + table + " (id INTEGER)")
+					return err
+				},
+				Down: func(tx *sql.Tx) error {
+					_, err := tx.Exec("DROP TABLE " + table)
+					return err
+				},
+			})
+		}
+	})
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	clearConfigEnv(t)
+	t.Setenv("MIGRATIONS_DIR", filepath.Join(dir, "migrations"))
+	migration.SetLogger(migration.NopLogger())
+	return filepath.Join(dir, "app.db")
+}
+
+// runMigrate runs the "migrate" command with the given arguments, answering
+// stdin to its questions
+func runMigrate(t *testing.T, stdin string, args ...string) {
+	t.Helper()
+
+	// Flags keep the values of the previous runs of the same command
+	cmd, _, err := MigrateCmd.Find(args)
+	if err != nil {
+		t.Fatalf("Unable to find command %v: %s", args, err)
+	}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		f.Value.Set(f.DefValue)
+		f.Changed = false
+	})
+
+	MigrateCmd.SetIn(strings.NewReader(stdin))
+	MigrateCmd.SetArgs(args)
+	if err := MigrateCmd.Execute(); err != nil {
+		t.Fatalf("Unable to run %v: %s", args, err)
+	}
+}
+
+// applied reports whether the migration with the given version is applied
+// in the database at path
+func applied(t *testing.T, path string, version string) bool {
+	t.Helper()
+
+	db, err := sql.Open(migration.DriverSQLite, "file:"+path)
+	if err != nil {
+		t.Fatalf("Unable to open database: %s", err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE version = ?", version).Scan(&count); err != nil {
+		t.Fatalf("Unable to read the migrations table: %s", err)
+	}
+	return count == 1
+}
+
+func TestDestructiveCommandsAbortInProduction(t *testing.T) {
+	for _, command := range []string{"down", "reset", "refresh", "fresh"} {
+		t.Run(command, func(t *testing.T) {
+			path := newCommandTestDB(t)
+
+			runMigrate(t, "n\n", command, "-d", "sqlite", "-u", "file:"+path, "--env", "prod")
+
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("Expected %s to abort before connecting, got %v", command, err)
+			}
+		})
+	}
+}
+
+func TestDownConfirmationInProduction(t *testing.T) {
+	path := newCommandTestDB(t)
+	dsn := "file:" + path
+
+	// No answer is a refusal, so the commands below don't prompt
+	runMigrate(t, "", "up", "-d", "sqlite", "-u", dsn, "--env", "prod")
+	runMigrate(t, "", "down", "-d", "sqlite", "-u", dsn, "--env", "prod", "--dry-run", "-o", "plan.sql")
+	if plan, err := os.ReadFile("plan.sql"); err != nil || !strings.Contains(string(plan), "DROP TABLE posts") {
+		t.Errorf("Expected the dry run to write the plan without asking, got %q, %v", plan, err)
+	}
+	if !applied(t, path, "20240102000000") {
+		t.Fatalf("Expected the dry run to leave posts applied")
+	}
+
+	runMigrate(t, "", "down", "-d", "sqlite", "-u", dsn, "--env", "prod", "--force")
+	if applied(t, path, "20240102000000") {
+		t.Errorf("Expected --force to revert posts without asking")
+	}
+
+	runMigrate(t, "", "up", "-d", "sqlite", "-u", dsn)
+	runMigrate(t, "", "down", "-d", "sqlite", "-u", dsn, "--env", "dev")
+	if applied(t, path, "20240102000000") {
+		t.Errorf("Expected down to revert posts without asking outside of production")
+	}
+}
+
+func TestGotoConfirmationInProduction(t *testing.T) {
+	path := newCommandTestDB(t)
+	dsn := "file:" + path
+
+	runMigrate(t, "", "up", "-d", "sqlite", "-u", dsn)
+
+	runMigrate(t, "n\n", "goto", "20240101000000", "-d", "sqlite", "-u", dsn, "--env", "prod")
+	if !applied(t, path, "20240102000000") {
+		t.Fatalf("Expected goto to abort when the revert is refused")
+	}
+
+	runMigrate(t, "y\n", "goto", "20240101000000", "-d", "sqlite", "-u", dsn, "--env", "prod")
+	if applied(t, path, "20240102000000") {
+		t.Errorf("Expected goto to revert posts once confirmed")
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lemmego/migration"
+	"gopkg.in/yaml.v3"
+)
+
+// writeStatus writes the migration states to w in the given format
+func writeStatus(w io.Writer, format string, states []migration.MigrationState) error {
+	switch format {
+	case "table", "":
+		return writeStatusTable(w, states)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(states)
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		defer enc.Close()
+		return enc.Encode(states)
+	}
+
+	return fmt.Errorf("unknown format %q, expected \"table\", \"json\" or \"yaml\"", format)
+}
+
+// writeStatusTable writes the migration states as an aligned table
+func writeStatusTable(w io.Writer, states []migration.MigrationState) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tBATCH\tAPPLIED AT\tAPPLIED BY\tDURATION")
+
+	for _, state := range states {
+		if !state.Applied {
+			status := "pending"
+			if state.OutOfOrder {
+				status = "pending (out of order)"
+			} else if state.Skipped {
+				status = "skipped (environment)"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t\t\t\t\n", state.Version, state.Name, status)
+			continue
+		}
+
+		appliedAt := "unknown"
+		if state.AppliedAt != nil {
+			appliedAt = state.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		appliedBy := state.AppliedBy
+		if appliedBy == "" {
+			appliedBy = "unknown"
+		}
+		status := "applied"
+		if state.Dirty {
+			status = "dirty"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			state.Version, state.Name, status, state.Batch, appliedAt, appliedBy, time.Duration(state.ExecutionMs)*time.Millisecond)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,217 @@
+package migration
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFiles are the files FindConfigFile looks for in the working
+// directory, in order
+var ConfigFiles = []string{"migrate.yaml", "migrate.yml", "migrate.toml"}
+
+// Config is the content of a migrate.yaml or migrate.toml file. The
+// settings at the top level apply to every connection unless the
+// connection overrides them.
+type Config struct {
+	// Default names the connection used when none is selected. It may be
+	// left out when there is a single connection.
+	Default       string `yaml:"default" toml:"default"`
+	MigrationsDir string `yaml:"migrations_dir" toml:"migrations_dir"`
+	Table         string `yaml:"table" toml:"table"`
+	Schema        string `yaml:"schema" toml:"schema"`
+
+	Connections map[string]Connection `yaml:"connections" toml:"connections"`
+
+	// Environments override the settings above in the environment of the
+	// same name, e.g. the DSN of a connection in "prod"
+	Environments map[string]Config `yaml:"environments" toml:"environments"`
+}
+
+// Connection describes a database, by DSN or by its parts
+type Connection struct {
+	Driver   string `yaml:"driver" toml:"driver"`
+	DSN      string `yaml:"dsn" toml:"dsn"`
+	Host     string `yaml:"host" toml:"host"`
+	Port     string `yaml:"port" toml:"port"`
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+	Database string `yaml:"database" toml:"database"`
+	Params   string `yaml:"params" toml:"params"`
+
+	MigrationsDir string `yaml:"migrations_dir" toml:"migrations_dir"`
+	Table         string `yaml:"table" toml:"table"`
+	Schema        string `yaml:"schema" toml:"schema"`
+}
+
+// FindConfigFile returns the path of the config file named by the
+// MIGRATE_CONFIG env variable, or else of the first of ConfigFiles found
+// in the working directory. It returns an empty string if there is none.
+func FindConfigFile() string {
+	if path := os.Getenv("MIGRATE_CONFIG"); path != "" {
+		return path
+	}
+
+	for _, name := range ConfigFiles {
+		if info, err := os.Stat(name); err == nil && !info.IsDir() {
+			return name
+		}
+	}
+	return ""
+}
+
+// envReferencePattern matches a reference to an env variable in a config
+// file, such as ${DB_PASSWORD}
+var envReferencePattern = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// LoadConfig reads a YAML or TOML config file, depending on its extension.
+// References to env variables such as ${DB_PASSWORD} are expanded in the
+// values; any other "$" is kept as is.
+func LoadConfig(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, config)
+	case ".toml":
+		err = toml.Unmarshal(content, config)
+	default:
+		return nil, fmt.Errorf("unsupported config file %s, use .yaml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+
+	config.expandEnv()
+	return config, nil
+}
+
+// expandEnv expands the references to env variables in the settings of the
+// config, its connections and its environments
+func (c *Config) expandEnv() {
+	for _, field := range []*string{&c.Default, &c.MigrationsDir, &c.Table, &c.Schema} {
+		*field = expandEnv(*field)
+	}
+
+	for name, conn := range c.Connections {
+		conn.expandEnv()
+		c.Connections[name] = conn
+	}
+
+	for name, env := range c.Environments {
+		env.expandEnv()
+		c.Environments[name] = env
+	}
+}
+
+// expandEnv expands the references to env variables in the settings of
+// the connection
+func (c *Connection) expandEnv() {
+	fields := []*string{
+		&c.Driver, &c.DSN, &c.Host, &c.Port, &c.Username, &c.Password, &c.Database, &c.Params,
+		&c.MigrationsDir, &c.Table, &c.Schema,
+	}
+	for _, field := range fields {
+		*field = expandEnv(*field)
+	}
+}
+
+// expandEnv replaces the references such as ${DB_PASSWORD} in value with
+// the value of the env variable
+func expandEnv(value string) string {
+	return envReferencePattern.ReplaceAllStringFunc(value, func(reference string) string {
+		return os.Getenv(envReferencePattern.FindStringSubmatch(reference)[1])
+	})
+}
+
+// Connection returns the named connection as seen in the environment env,
+// with the settings inherited from the top level and the overrides of env
+// applied. An empty name selects the default connection, or the only one
+// configured. It returns nil when there is no such connection to select.
+func (c *Config) Connection(name string, env string) (*Connection, error) {
+	if name == "" {
+		name = c.Default
+	}
+	if name == "" {
+		if len(c.Connections) != 1 {
+			return nil, nil
+		}
+		for only := range c.Connections {
+			name = only
+		}
+	}
+
+	base, ok := c.Connections[name]
+	if !ok {
+		names := make([]string, 0, len(c.Connections))
+		for n := range c.Connections {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		return nil, fmt.Errorf("connection %q is not configured (available: %s)", name, strings.Join(names, ", "))
+	}
+
+	conn := Connection{MigrationsDir: c.MigrationsDir, Table: c.Table, Schema: c.Schema}
+	conn.merge(base)
+
+	if override, ok := c.Environments[env]; ok {
+		conn.merge(Connection{MigrationsDir: override.MigrationsDir, Table: override.Table, Schema: override.Schema})
+		conn.merge(override.Connections[name])
+	}
+
+	return &conn, nil
+}
+
+// merge overwrites the settings of c with those set in other
+func (c *Connection) merge(other Connection) {
+	fields := []struct {
+		dst *string
+		src string
+	}{
+		{&c.Driver, other.Driver},
+		{&c.DSN, other.DSN},
+		{&c.Host, other.Host},
+		{&c.Port, other.Port},
+		{&c.Username, other.Username},
+		{&c.Password, other.Password},
+		{&c.Database, other.Database},
+		{&c.Params, other.Params},
+		{&c.MigrationsDir, other.MigrationsDir},
+		{&c.Table, other.Table},
+		{&c.Schema, other.Schema},
+	}
+	for _, field := range fields {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+}
+
+// DataSourceName returns the DSN of the connection, built from its parts
+// when DSN isn't set
+func (c *Connection) DataSourceName() (string, error) {
+	if c.DSN != "" {
+		return c.DSN, nil
+	}
+
+	ds := DataSource{
+		Driver:   c.Driver,
+		Host:     c.Host,
+		Port:     c.Port,
+		Username: c.Username,
+		Password: c.Password,
+		Name:     c.Database,
+		Params:   c.Params,
+	}
+	return ds.String()
+}
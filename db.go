@@ -3,24 +3,52 @@ package migration
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"net/url"
+	"regexp"
 )
 
-// NewDB creates a new database connection
-func NewDB(dsn string, driverName string) *sql.DB {
-	fmt.Println("Connecting to database...")
-	fmt.Println("DSN:", dsn)
+// NewDB opens a database connection and checks that it works
+func NewDB(dsn string, driverName string) (*sql.DB, error) {
+	logger().Info("Connecting to database", "driver", driverName, "dsn", RedactDSN(dsn))
 
 	db, err := sql.Open(driverName, dsn)
 	if err != nil {
-		log.Fatal("Unable to connect to database: ", err.Error())
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
 
 	if err := db.Ping(); err != nil {
-		log.Fatal("Unable to ping the database: ", err.Error())
+		db.Close()
+		return nil, fmt.Errorf("unable to ping the database: %w", err)
 	}
 
-	fmt.Println("Database connected!")
+	logger().Info("Database connected")
 
-	return db
+	return db, nil
+}
+
+var (
+	// mysqlPasswordPattern matches the password of user:password@tcp(host)/db,
+	// which like for the driver ends at the last "@" before the database
+	mysqlPasswordPattern = regexp.MustCompile(`^([^:@/]*):(.*)@([^@]*)/`)
+	// keyValuePasswordPattern matches the password of host=h password=p
+	keyValuePasswordPattern = regexp.MustCompile(`(?i)(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+)
+
+// RedactDSN hides the password of a DSN so it can be logged. URLs,
+// Postgres key/value strings and MySQL DSNs are supported.
+func RedactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" && u.Host != "" {
+		query := u.Query()
+		if query.Has("password") {
+			query.Set("password", "xxxxx")
+			u.RawQuery = query.Encode()
+		}
+		return u.Redacted()
+	}
+
+	if mysqlPasswordPattern.MatchString(dsn) {
+		return mysqlPasswordPattern.ReplaceAllString(dsn, "${1}:xxxxx@${3}/")
+	}
+
+	return keyValuePasswordPattern.ReplaceAllString(dsn, "${1}xxxxx")
 }
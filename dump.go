@@ -0,0 +1,140 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// dialectDirective names the dialect of a schema dump
+const dialectDirective = "-- schema:dialect"
+
+// SchemaFile returns the default path of the schema dump, schema.sql in
+// the migrations directory of the Migrator
+func (m *Migrator) SchemaFile() string {
+	return filepath.Join(m.MigrationsDir(), "schema.sql")
+}
+
+// DumpSchema writes the schema of the database to w, see DumpSchemaContext
+func (m *Migrator) DumpSchema(w io.Writer) error {
+	return m.DumpSchemaContext(context.Background(), w)
+}
+
+// DumpSchemaContext writes the statements creating the tables, indexes
+// and views of the database, followed by the rows of the migrations table,
+// in the dialect of the database. LoadSchema reads it back.
+func (m *Migrator) DumpSchemaContext(ctx context.Context, w io.Writer) error {
+	return m.withLock(ctx, func() error {
+		if err := m.checkDirty(); err != nil {
+			return err
+		}
+
+		objects, err := m.introspectSchema(ctx)
+		if err != nil {
+			return err
+		}
+
+		rows, err := m.db.QueryContext(ctx, "SELECT version, batch, checksum, applied_at, execution_ms, applied_by FROM "+m.table()+" ORDER BY version;")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s %s\n", dialectDirective, m.dialect)
+		if latest := m.latestApplied(); latest != "" {
+			fmt.Fprintf(&b, "-- Schema migrated up to %s\n", latest)
+		}
+		b.WriteString("\n")
+		b.WriteString(createStatements(objects))
+		b.WriteString("\n")
+
+		for rows.Next() {
+			values := make([]any, 6)
+			dest := make([]any, len(values))
+			for i := range values {
+				dest[i] = &values[i]
+			}
+			if err := rows.Scan(dest...); err != nil {
+				return err
+			}
+
+			literals := make([]string, len(values))
+			for i, value := range values {
+				literals[i] = sqlLiteral(value)
+			}
+			fmt.Fprintf(&b, "INSERT INTO %s (version, batch, checksum, applied_at, execution_ms, applied_by) VALUES (%s);\n", m.table(), strings.Join(literals, ", "))
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(w, b.String())
+		return err
+	})
+}
+
+// LoadSchema creates the schema written by DumpSchema, see LoadSchemaContext
+func (m *Migrator) LoadSchema(r io.Reader) error {
+	return m.LoadSchemaContext(context.Background(), r)
+}
+
+// LoadSchemaContext runs the statements of a schema dump against an empty
+// database, in a single transaction where the dialect allows it. The
+// migrations recorded in the dump are then applied, so Up only runs the
+// migrations newer than the dump.
+func (m *Migrator) LoadSchemaContext(ctx context.Context, r io.Reader) error {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	dump := string(content)
+
+	if dialect := dumpDialect(dump); dialect != "" && dialect != m.dialect {
+		return fmt.Errorf("the schema was dumped from %s, not %s", dialect, m.dialect)
+	}
+
+	return m.withLock(ctx, func() error {
+		if len(m.history) > 0 {
+			return errors.New("the migrations table is not empty, the schema can only be loaded into a fresh database")
+		}
+
+		objects, err := m.introspectSchema(ctx)
+		if err != nil {
+			return err
+		}
+		for _, object := range objects {
+			if object.kind == "table" || object.kind == "view" {
+				return fmt.Errorf("the database already has %s %s, the schema can only be loaded into a fresh database", object.kind, object.name)
+			}
+		}
+
+		tx, err := m.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if err := execStatements(ctx, tx, dump); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		m.log().Info("Loaded schema")
+		return m.loadApplied(ctx)
+	})
+}
+
+// dumpDialect returns the dialect named by a schema dump, if any
+func dumpDialect(dump string) string {
+	for _, line := range strings.Split(dump, "\n") {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), dialectDirective+" "); ok {
+			return strings.TrimSpace(rest)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package migration
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDumpAndLoadSchema(t *testing.T) {
+	migrations := []*Migration{
+		createTableMigration("20240101000000", "users"),
+		createTableMigration("20240102000000", "posts"),
+		createTableMigration("20240103000000", "tags"),
+	}
+
+	m := newTestMigrator(t, migrations...)
+	if err := m.Up(2); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	var dump bytes.Buffer
+	if err := m.DumpSchema(&dump); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if !strings.HasPrefix(dump.String(), "-- schema:dialect sqlite\n") || strings.Contains(dump.String(), "CREATE TABLE schema_migrations") {
+		t.Errorf("Unexpected dump:\n%s", dump.String())
+	}
+
+	fresh := newTestMigrator(t, migrations...)
+	if err := fresh.LoadSchema(bytes.NewReader(dump.Bytes())); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, fresh.db); !reflect.DeepEqual(got, []string{"20240101000000", "20240102000000"}) {
+		t.Errorf("Expected the dumped versions to be applied, got %v", got)
+	}
+
+	// Only the migration newer than the dump runs
+	if err := fresh.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, fresh.db); len(got) != 3 {
+		t.Errorf("Expected 3 applied versions, got %v", got)
+	}
+
+	if err := fresh.LoadSchema(bytes.NewReader(dump.Bytes())); err == nil {
+		t.Errorf("Expected loading into a migrated database to fail")
+	}
+}
+
+func TestLoadSchemaRejectsOtherDialect(t *testing.T) {
+	m := newTestMigrator(t)
+
+	err := m.LoadSchema(strings.NewReader("-- schema:dialect postgres\nCREATE TABLE users (id integer);\n"))
+	if err == nil || !strings.Contains(err.Error(), "dumped from postgres") {
+		t.Fatalf("Expected a dialect mismatch, got %v", err)
+	}
+}
@@ -5,8 +5,10 @@ go 1.25.0
 require github.com/spf13/cobra v1.8.1
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/gertd/go-pluralize v0.2.1
 	github.com/glebarez/go-sqlite v1.22.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -28,5 +30,5 @@ require (
 	github.com/go-sql-driver/mysql v1.9.3
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/lib/pq v1.10.9
-	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/spf13/pflag v1.0.5
 )
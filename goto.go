@@ -0,0 +1,84 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+)
+
+// To migrates the database to the given version, see ToContext
+func (m *Migrator) To(version string) error {
+	return m.ToContext(context.Background(), version)
+}
+
+// ToContext migrates the database so that version is the last applied
+// migration. Applied migrations newer than version are reverted, newest
+// first, then the pending migrations up to version are applied in order.
+// It fails if version isn't registered.
+func (m *Migrator) ToContext(ctx context.Context, version string) error {
+	if m.Migrations[version] == nil {
+		return fmt.Errorf("migration %s is not registered", version)
+	}
+
+	return m.withLock(ctx, func() error {
+		if err := m.checkDirty(); err != nil {
+			return err
+		}
+
+		revert, apply, err := m.pathTo(version)
+		if err != nil {
+			return err
+		}
+
+		// The newest migration left applied once the others are reverted
+		latest := ""
+		for v := range m.history {
+			if v <= version {
+				latest = max(latest, v)
+			}
+		}
+		if err := m.checkOrder(apply, latest); err != nil {
+			return err
+		}
+		if err := m.checkSquashes(apply); err != nil {
+			return err
+		}
+
+		if len(revert) > 0 {
+			if err := m.run(ctx, DirectionDown, revert, 0); err != nil {
+				return err
+			}
+		}
+
+		if len(apply) == 0 {
+			return nil
+		}
+
+		lastBatch, err := m.lastBatch(ctx)
+		if err != nil {
+			return err
+		}
+		return m.run(ctx, DirectionUp, apply, lastBatch+1)
+	})
+}
+
+// pathTo returns the migrations to revert, newest first, and the ones to
+// apply, oldest first, to land on version
+func (m *Migrator) pathTo(version string) (revert []*Migration, apply []*Migration, err error) {
+	applied, err := m.appliedMigrations()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, mg := range applied {
+		if mg.Version > version {
+			revert = append(revert, mg)
+		}
+	}
+
+	for _, mg := range m.pending(0) {
+		if mg.Version <= version {
+			apply = append(apply, mg)
+		}
+	}
+
+	return revert, apply, nil
+}
@@ -0,0 +1,44 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTo(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		createTableMigration("20240102000000", "posts"),
+		createTableMigration("20240103000000", "tags"),
+	)
+
+	if err := m.To("20240102000000"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); !reflect.DeepEqual(got, []string{"20240101000000", "20240102000000"}) {
+		t.Errorf("Expected to migrate up to 20240102000000, got %v", got)
+	}
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if err := m.To("20240101000000"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); !reflect.DeepEqual(got, []string{"20240101000000"}) {
+		t.Errorf("Expected to migrate down to 20240101000000, got %v", got)
+	}
+}
+
+func TestToRejectsUnknownVersion(t *testing.T) {
+	m := newTestMigrator(t, createTableMigration("20240101000000", "users"))
+
+	if err := m.To("20240105000000"); err == nil {
+		t.Error("Expected an error for an unregistered version")
+	}
+
+	if got := appliedVersions(t, m.db); len(got) != 0 {
+		t.Errorf("Expected no applied versions, got %v", got)
+	}
+}
@@ -0,0 +1,392 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// historyColumns are the columns added to the migrations table after its
+// first release, with their definition, in the order they were introduced.
+// Tables created by older versions are upgraded by adding the missing ones.
+var historyColumns = []struct {
+	name       string
+	definition string
+}{
+	{"checksum", "varchar(64)"},
+	{"applied_at", "TIMESTAMP NULL"},
+	{"execution_ms", "bigint"},
+	{"applied_by", "varchar(255)"},
+	{"dirty", "varchar(4)"},
+}
+
+// historyRecord is a row of the migrations table
+type historyRecord struct {
+	version     string
+	batch       int
+	checksum    string
+	appliedAt   time.Time
+	executionMs int64
+	appliedBy   string
+	// dirty is the direction of a run interrupted while this migration
+	// was being applied or reverted, see markDirty
+	dirty Direction
+}
+
+// ensureTable creates the migrations table that remembers which migrations
+// were executed, and upgrades tables created by older versions. The table
+// is inspected through the database of the Migrator and changed through
+// db, which Plan points at its recorder. The caller holds the lock, or
+// knows no other process can change the table.
+func (m *Migrator) ensureTable(ctx context.Context, db Executor) error {
+	columns, err := m.tableColumns(ctx)
+	if err != nil {
+		// The table doesn't exist yet, it is created with every column
+		if m.schema != "" && m.dialect == DriverPostgres {
+			if _, err := db.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+m.schema+";"); err != nil {
+				return err
+			}
+		}
+
+		if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+m.table()+` (
+			version varchar(255) NOT NULL,
+			batch int,
+			checksum varchar(64),
+			applied_at TIMESTAMP NULL,
+			execution_ms bigint,
+			applied_by varchar(255),
+			dirty varchar(4)
+		);`); err != nil {
+			return err
+		}
+
+		columns = []string{"version", "batch"}
+		for _, column := range historyColumns {
+			columns = append(columns, column.name)
+		}
+	}
+
+	for _, column := range historyColumns {
+		if slices.Contains(columns, column.name) {
+			continue
+		}
+
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", m.table(), column.name, column.definition)); err != nil {
+			return fmt.Errorf("unable to add column %s to `%s`: %w", column.name, m.table(), err)
+		}
+	}
+
+	exists, err := m.uniqueVersionExists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if _, err := db.ExecContext(ctx, "CREATE UNIQUE INDEX "+m.uniqueVersionIndex()+" ON "+m.uniqueVersionTable()+" (version);"); err != nil {
+			return fmt.Errorf("unable to add a unique constraint on `%s`.version, remove any duplicate rows first: %w", m.table(), err)
+		}
+	}
+
+	return nil
+}
+
+// tableReady reports whether the migrations table exists with every column
+// and the unique index, so ensureTable has nothing to do
+func (m *Migrator) tableReady(ctx context.Context) bool {
+	columns, err := m.tableColumns(ctx)
+	if err != nil {
+		// Most likely the table doesn't exist yet
+		return false
+	}
+
+	for _, column := range historyColumns {
+		if !slices.Contains(columns, column.name) {
+			return false
+		}
+	}
+
+	exists, err := m.uniqueVersionExists(ctx)
+	return err == nil && exists
+}
+
+// tableColumns returns the columns of the migrations table
+func (m *Migrator) tableColumns(ctx context.Context) ([]string, error) {
+	// Selecting no rows is enough to learn the existing columns on every dialect
+	rows, err := m.db.QueryContext(ctx, "SELECT * FROM "+m.table()+" WHERE 1 = 0;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return rows.Columns()
+}
+
+// uniqueVersionIndex returns the name of the unique index on the version
+// column, which tables created by older versions lack. SQLite qualifies
+// the index rather than the table with the schema.
+func (m *Migrator) uniqueVersionIndex() string {
+	index := m.tableName + "_version_unique"
+	if m.schema != "" && m.dialect == DriverSQLite {
+		return m.schema + "." + index
+	}
+	return index
+}
+
+// uniqueVersionTable returns the table as named in CREATE INDEX
+func (m *Migrator) uniqueVersionTable() string {
+	if m.dialect == DriverSQLite {
+		return m.tableName
+	}
+	return m.table()
+}
+
+// uniqueVersionExists reports whether the unique index on the version
+// column exists
+func (m *Migrator) uniqueVersionExists(ctx context.Context) (bool, error) {
+	index := m.tableName + "_version_unique"
+
+	var count int
+	var err error
+	switch m.dialect {
+	case DriverSQLite:
+		master := "sqlite_master"
+		if m.schema != "" {
+			master = m.schema + "." + master
+		}
+		err = m.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+master+" WHERE type = 'index' AND name = ?;", index).Scan(&count)
+	case DriverPostgres:
+		err = m.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pg_indexes
+			WHERE schemaname = COALESCE(NULLIF($1, ''), current_schema()) AND tablename = $2 AND indexname = $3;`, m.schema, m.tableName, index).Scan(&count)
+	default:
+		err = m.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM information_schema.statistics
+			WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND table_name = ? AND index_name = ?;`, m.schema, m.tableName, index).Scan(&count)
+	}
+	return count > 0, err
+}
+
+// loadApplied reads the migrations table to learn which migrations were applied
+func (m *Migrator) loadApplied(ctx context.Context) error {
+	selected := "version, batch, checksum, applied_at, execution_ms, applied_by, dirty"
+	if m.readOnly {
+		// The table may not be created or upgraded yet, see WithReadOnly
+		columns, err := m.tableColumns(ctx)
+		if err != nil {
+			m.history = map[string]*historyRecord{}
+			return nil
+		}
+
+		fields := []string{"version", "batch"}
+		for _, column := range historyColumns {
+			if slices.Contains(columns, column.name) {
+				fields = append(fields, column.name)
+			} else {
+				fields = append(fields, "NULL AS "+column.name)
+			}
+		}
+		selected = strings.Join(fields, ", ")
+	}
+
+	// Find out all the executed migrations
+	rows, err := m.db.QueryContext(ctx, "SELECT "+selected+" FROM "+m.table()+";")
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	history := map[string]*historyRecord{}
+	for rows.Next() {
+		var (
+			version     string
+			batch       sql.NullInt64
+			sum         sql.NullString
+			appliedAt   any
+			executionMs sql.NullInt64
+			appliedBy   sql.NullString
+			dirty       sql.NullString
+		)
+		if err := rows.Scan(&version, &batch, &sum, &appliedAt, &executionMs, &appliedBy, &dirty); err != nil {
+			return err
+		}
+
+		history[version] = &historyRecord{
+			version:     version,
+			batch:       int(batch.Int64),
+			checksum:    sum.String,
+			appliedAt:   parseTimestamp(appliedAt),
+			executionMs: executionMs.Int64,
+			appliedBy:   appliedBy.String,
+			dirty:       Direction(dirty.String),
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	m.history = history
+	return nil
+}
+
+// applied reports whether the migration with the given version was applied
+func (m *Migrator) applied(version string) bool {
+	return m.history[version] != nil
+}
+
+// timestampLayouts are the formats drivers return timestamps in when they
+// don't convert them to time.Time, e.g. MySQL without parseTime=true
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// parseTimestamp converts a scanned timestamp column into a time.Time,
+// returning the zero time for NULL or unparsable values
+func parseTimestamp(value any) time.Time {
+	var s string
+	switch v := value.(type) {
+	case time.Time:
+		return v
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return time.Time{}
+	}
+
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// lastBatch returns the highest batch number recorded, or 0
+func (m *Migrator) lastBatch(ctx context.Context) (int, error) {
+	if m.readOnly {
+		// The table may not exist yet, the loaded history is all there is
+		lastBatch := 0
+		for _, record := range m.history {
+			lastBatch = max(lastBatch, record.batch)
+		}
+		return lastBatch, nil
+	}
+
+	var lastBatch *int // use a pointer to int to allow for NULL values
+	if err := m.db.QueryRowContext(ctx, "SELECT MAX(batch) FROM "+m.table()+";").Scan(&lastBatch); err != nil {
+		return 0, err
+	}
+	if lastBatch == nil {
+		return 0, nil
+	}
+	return *lastBatch, nil
+}
+
+// recordUp records mg as applied in the given batch
+func (m *Migrator) recordUp(ctx context.Context, db execer, mg *Migration, batch int, duration time.Duration) error {
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO "+m.table()+" (version, batch, checksum, applied_at, execution_ms, applied_by) VALUES ("+m.bindVars(6)+");",
+		mg.Version, batch, mg.Checksum, time.Now().UTC(), duration.Milliseconds(), appliedBy(),
+	)
+	return err
+}
+
+// tracksDirty reports whether a failure while running mg may leave the
+// database half migrated: NoTx migrations, and every migration on MySQL
+// where DDL statements commit implicitly
+func (m *Migrator) tracksDirty(mg *Migration) bool {
+	return mg.NoTx || m.dialect == DriverMySQL
+}
+
+// markDirty records, outside of any transaction, that mg is about to be
+// applied or reverted, so that a crash or failure halfway leaves a trace.
+// Applying inserts the record of mg as dirty, which finishUp cleans. Reverting
+// flags the existing record, which recordDown then deletes.
+func (m *Migrator) markDirty(ctx context.Context, mg *Migration, direction Direction, batch int) error {
+	if direction == DirectionUp {
+		_, err := m.db.ExecContext(ctx,
+			"INSERT INTO "+m.table()+" (version, batch, checksum, applied_at, applied_by, dirty) VALUES ("+m.bindVars(6)+");",
+			mg.Version, batch, mg.Checksum, time.Now().UTC(), appliedBy(), string(DirectionUp),
+		)
+		return err
+	}
+
+	return m.setDirty(ctx, m.db, mg.Version, DirectionDown)
+}
+
+// setDirty sets the dirty flag of the record of version, or clears it when
+// direction is empty
+func (m *Migrator) setDirty(ctx context.Context, db execer, version string, direction Direction) error {
+	var dirty any
+	if direction != "" {
+		dirty = string(direction)
+	}
+
+	_, err := db.ExecContext(ctx, "UPDATE "+m.table()+" SET dirty = "+m.bindVar(1)+" WHERE version = "+m.bindVar(2)+";", dirty, version)
+	return err
+}
+
+// finishUp records mg as applied once it ran, cleaning the record left by
+// markDirty if any
+func (m *Migrator) finishUp(ctx context.Context, db execer, mg *Migration, batch int, duration time.Duration) error {
+	if !m.tracksDirty(mg) {
+		return m.recordUp(ctx, db, mg, batch, duration)
+	}
+
+	_, err := db.ExecContext(ctx,
+		"UPDATE "+m.table()+" SET dirty = NULL, applied_at = "+m.bindVar(1)+", execution_ms = "+m.bindVar(2)+" WHERE version = "+m.bindVar(3)+";",
+		time.Now().UTC(), duration.Milliseconds(), mg.Version,
+	)
+	return err
+}
+
+// recordDown removes the record of mg
+func (m *Migrator) recordDown(ctx context.Context, db execer, mg *Migration) error {
+	for _, version := range append([]string{mg.Version}, mg.Squashes...) {
+		if _, err := db.ExecContext(ctx, "DELETE FROM "+m.table()+" WHERE version = "+m.bindVars(1)+";", version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checksum returns the hex encoded SHA-256 hash of content
+func checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// appliedBy identifies who applied a migration, as user@host
+func appliedBy() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return name + "@" + host
+}
+
+// identifierPattern matches the table and schema names accepted in options
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// table returns the migrations table name, qualified with its schema if set
+func (m *Migrator) table() string {
+	if m.schema != "" {
+		return m.schema + "." + m.tableName
+	}
+	return m.tableName
+}
@@ -0,0 +1,236 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpRecordsHistory(t *testing.T) {
+	m := newTestMigrator(t, createTableMigration("20240101000000", "users"))
+
+	before := time.Now().Add(-time.Second)
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if err := m.loadApplied(context.Background()); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	record := m.history["20240101000000"]
+	if record == nil {
+		t.Fatal("Expected 20240101000000 to be recorded")
+	}
+
+	if record.batch != 1 {
+		t.Errorf("Expected batch 1, got %d", record.batch)
+	}
+
+	if record.appliedAt.Before(before) {
+		t.Errorf("Expected applied_at after %s, got %s", before, record.appliedAt)
+	}
+
+	if record.appliedBy != appliedBy() {
+		t.Errorf("Expected applied_by %s, got %s", appliedBy(), record.appliedBy)
+	}
+}
+
+func TestVersionIsUnique(t *testing.T) {
+	m := newTestMigrator(t)
+
+	if _, err := m.db.Exec("INSERT INTO schema_migrations (version, batch) VALUES ('20240101000000', 1);"); err != nil {
+		t.Fatalf("Unable to insert version: %s", err)
+	}
+
+	if _, err := m.db.Exec("INSERT INTO schema_migrations (version, batch) VALUES ('20240101000000', 2);"); err == nil {
+		t.Error("Expected inserting a version twice to fail")
+	}
+}
+
+func TestEnsureTableRejectsDuplicateLegacyRows(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec("CREATE TABLE schema_migrations (version varchar(255), batch int); INSERT INTO schema_migrations VALUES ('20240101000000', 1), ('20240101000000', 1);"); err != nil {
+		t.Fatalf("Unable to create legacy table: %s", err)
+	}
+
+	if _, err := New(db, DriverSQLite); err == nil {
+		t.Error("Expected an error for duplicate versions")
+	}
+}
+
+func TestConcurrentInitUpgradesLegacyTable(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec("CREATE TABLE schema_migrations (version varchar(255), batch int); INSERT INTO schema_migrations VALUES ('20240101000000', 1);"); err != nil {
+		t.Fatalf("Unable to create legacy table: %s", err)
+	}
+
+	// Replicas starting at once must not add the same columns twice
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = New(db, DriverSQLite, WithLogger(NopLogger()))
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("Expected error to be nil, got %s", err)
+		}
+	}
+	if got := appliedVersions(t, db); !reflect.DeepEqual(got, []string{"20240101000000"}) {
+		t.Errorf("Expected the legacy row to be kept, got %v", got)
+	}
+}
+
+func TestForceUnlockBeforeUpgradingLegacyTable(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec("CREATE TABLE schema_migrations (version varchar(255), batch int); INSERT INTO schema_migrations VALUES ('20240101000000', 1);"); err != nil {
+		t.Fatalf("Unable to create legacy table: %s", err)
+	}
+
+	// A process crashed while holding the lock
+	stale, err := newLocker(db, DriverSQLite, "schema_migrations")
+	if err != nil {
+		t.Fatalf("Unable to create locker: %s", err)
+	}
+	if err := stale.lock(context.Background(), time.Second); err != nil {
+		t.Fatalf("Unable to acquire lock: %s", err)
+	}
+
+	if _, err := New(db, DriverSQLite, WithLogger(NopLogger()), WithLockTimeout(100*time.Millisecond)); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("Expected the upgrade to wait for the lock, got %v", err)
+	}
+
+	m, err := New(db, DriverSQLite, WithLogger(NopLogger()), WithLockTimeout(100*time.Millisecond), WithReadOnly(true))
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if err := m.ForceUnlock(); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if _, err := New(db, DriverSQLite, WithLogger(NopLogger()), WithLockTimeout(100*time.Millisecond)); err != nil {
+		t.Errorf("Expected the table to be upgraded once unlocked, got %s", err)
+	}
+}
+
+func TestWithTableName(t *testing.T) {
+	r := NewRegistry()
+	r.AddMigration(createTableMigration("20240101000000", "users"))
+
+	db := newTestDB(t)
+	m, err := New(db, DriverSQLite, WithRegistry(r), WithTableName("billing_migrations"))
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM billing_migrations").Scan(&count); err != nil || count != 1 {
+		t.Errorf("Expected 1 row in billing_migrations, got %d (%v)", count, err)
+	}
+
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&count); err == nil {
+		t.Error("Expected schema_migrations not to be created")
+	}
+}
+
+func TestInvalidTableNameIsRejected(t *testing.T) {
+	if _, err := New(newTestDB(t), DriverSQLite, WithTableName("users; DROP TABLE users")); err == nil {
+		t.Error("Expected an error for an invalid table name")
+	}
+}
+
+// failingNoTxMigration returns a NoTx migration that fails halfway
+func failingNoTxMigration(version string) *Migration {
+	return &Migration{
+		Version: version,
+		NoTx:    true,
+		UpDB: func(db *sql.DB) error {
+			if _, err := db.Exec("CREATE TABLE half (id INTEGER)"); err != nil {
+				return err
+			}
+			return errors.New("boom")
+		},
+	}
+}
+
+func TestInterruptedMigrationMakesDatabaseDirty(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		failingNoTxMigration("20240102000000"),
+		createTableMigration("20240103000000", "posts"),
+	)
+
+	if err := m.Up(0); err == nil {
+		t.Fatal("Expected the NoTx migration to fail")
+	}
+
+	var dirtyErr *DirtyError
+	if err := m.Up(0); !errors.As(err, &dirtyErr) || !reflect.DeepEqual(dirtyErr.Versions, []string{"20240102000000"}) {
+		t.Fatalf("Expected a DirtyError for 20240102000000, got %v", err)
+	}
+	if err := m.DownSteps(1); !errors.As(err, &dirtyErr) {
+		t.Fatalf("Expected a DirtyError, got %v", err)
+	}
+
+	states, err := m.MigrationStatus()
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if !states[1].Dirty {
+		t.Errorf("Expected 20240102000000 to be reported as dirty, got %+v", states[1])
+	}
+
+	// The schema was finished by hand
+	if err := m.Force("20240102000000"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); len(got) != 3 {
+		t.Errorf("Expected 3 applied versions, got %v", got)
+	}
+}
+
+func TestRepairUndoesInterruptedStep(t *testing.T) {
+	m := newTestMigrator(t, failingNoTxMigration("20240101000000"))
+
+	if err := m.Up(0); err == nil {
+		t.Fatal("Expected the NoTx migration to fail")
+	}
+
+	if err := m.Repair(); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if got := appliedVersions(t, m.db); len(got) != 0 {
+		t.Errorf("Expected the interrupted migration to be recorded as not applied, got %v", got)
+	}
+}
+
+func TestSuccessfulMigrationIsClean(t *testing.T) {
+	m := newTestMigrator(t, &Migration{Version: "20240101000000", NoTx: true})
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	var dirty sql.NullString
+	if err := m.db.QueryRow("SELECT dirty FROM schema_migrations WHERE version = '20240101000000'").Scan(&dirty); err != nil || dirty.Valid {
+		t.Errorf("Expected the record not to be dirty, got %v (%v)", dirty, err)
+	}
+}
@@ -0,0 +1,79 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Executor runs statements, it is implemented by *sql.DB and *sql.Tx
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Hook is called around the migrations of a run. db is the *sql.Tx the
+// migration runs in, or the *sql.DB for NoTx migrations and for the
+// BeforeAll and AfterAll hooks, which receive a nil migration. An error
+// aborts the run like a failing migration.
+type Hook func(ctx context.Context, db Executor, mg *Migration, direction Direction) error
+
+// dryRunKey marks the context of a dry run, see IsDryRun
+type dryRunKey struct{}
+
+// withDryRun returns a copy of ctx marked as the context of a dry run
+func withDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// IsDryRun reports whether ctx is the context of a dry run, see Plan. The
+// statements of hooks are recorded like those of migrations, but a hook
+// with effects outside of the database, e.g. sending a notification,
+// should skip them.
+func IsDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun
+}
+
+// hooks holds the hooks registered on a Migrator
+type hooks struct {
+	beforeAll  []Hook
+	afterAll   []Hook
+	beforeEach []Hook
+	afterEach  []Hook
+}
+
+// BeforeAll registers a hook called before the first migration of a run,
+// outside of any transaction. Runs with nothing to do don't call it.
+func (m *Migrator) BeforeAll(h Hook) {
+	m.hooks.beforeAll = append(m.hooks.beforeAll, h)
+}
+
+// AfterAll registers a hook called once every migration of a run was
+// committed, outside of any transaction
+func (m *Migrator) AfterAll(h Hook) {
+	m.hooks.afterAll = append(m.hooks.afterAll, h)
+}
+
+// BeforeEach registers a hook called before each migration, in the same
+// transaction, e.g. to SET LOCAL lock_timeout on Postgres
+func (m *Migrator) BeforeEach(h Hook) {
+	m.hooks.beforeEach = append(m.hooks.beforeEach, h)
+}
+
+// AfterEach registers a hook called after each migration was run and
+// recorded, in the same transaction
+func (m *Migrator) AfterEach(h Hook) {
+	m.hooks.afterEach = append(m.hooks.afterEach, h)
+}
+
+// runHooks calls the given hooks in the order they were registered,
+// stopping at the first error
+func runHooks(ctx context.Context, hooks []Hook, db Executor, mg *Migration, direction Direction) error {
+	for _, hook := range hooks {
+		if err := hook(ctx, db, mg, direction); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestHooksAreCalledAroundMigrations(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		&Migration{
+			Version: "20240102000000",
+			NoTx:    true,
+			UpDB: func(db *sql.DB) error {
+				_, err := db.Exec("CREATE INDEX users_id ON users (id)")
+				return err
+			},
+		},
+	)
+
+	calls := []string{}
+	record := func(name string) Hook {
+		return func(ctx context.Context, db Executor, mg *Migration, direction Direction) error {
+			call := name + " " + string(direction)
+			if mg != nil {
+				call += " " + mg.Version
+			}
+			if _, ok := db.(*sql.Tx); ok {
+				call += " tx"
+			}
+			calls = append(calls, call)
+			return nil
+		}
+	}
+	m.BeforeAll(record("beforeAll"))
+	m.AfterAll(record("afterAll"))
+	m.BeforeEach(record("beforeEach"))
+	m.AfterEach(record("afterEach"))
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	expected := []string{
+		"beforeAll up",
+		"beforeEach up 20240101000000 tx",
+		"afterEach up 20240101000000 tx",
+		"beforeEach up 20240102000000",
+		"afterEach up 20240102000000",
+		"afterAll up",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("\nExpected:\n%q\nGot:\n%q", expected, calls)
+	}
+
+	// Nothing left to run
+	calls = []string{}
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if len(calls) != 0 {
+		t.Errorf("Expected no hook to be called, got %q", calls)
+	}
+}
+
+func TestHookErrorAbortsRun(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		createTableMigration("20240102000000", "posts"),
+	)
+
+	boom := errors.New("boom")
+	m.AfterEach(func(ctx context.Context, db Executor, mg *Migration, direction Direction) error {
+		if mg.Version == "20240102000000" {
+			return boom
+		}
+		return nil
+	})
+
+	err := m.Up(0)
+
+	var migrationErr *MigrationError
+	if !errors.As(err, &migrationErr) || migrationErr.Version != "20240102000000" || !errors.Is(err, boom) {
+		t.Fatalf("Expected a MigrationError for 20240102000000, got %v", err)
+	}
+
+	if got := appliedVersions(t, m.db); len(got) != 0 {
+		t.Errorf("Expected the run to be rolled back, got %v", got)
+	}
+}
+
+func TestHooksSeeDryRun(t *testing.T) {
+	m := newTestMigrator(t, createTableMigration("20240101000000", "users"))
+
+	dryRuns := []bool{}
+	m.BeforeEach(func(ctx context.Context, db Executor, mg *Migration, direction Direction) error {
+		_, err := db.ExecContext(ctx, "SELECT 1")
+		return err
+	})
+	m.AfterAll(func(ctx context.Context, db Executor, mg *Migration, direction Direction) error {
+		dryRuns = append(dryRuns, IsDryRun(ctx))
+		return nil
+	})
+
+	statements, err := m.Plan(DirectionUp, 0)
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if !slices.Contains(statements, "SELECT 1;") {
+		t.Errorf("Expected the statement of the hook in the plan, got %q", statements)
+	}
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if !reflect.DeepEqual(dryRuns, []bool{true, false}) {
+		t.Errorf("Expected the hook to see the dry run only in the plan, got %v", dryRuns)
+	}
+}
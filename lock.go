@@ -0,0 +1,278 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"time"
+)
+
+// DefaultLockTimeout is how long Up and Down wait for a migration lock held
+// by another process before giving up
+const DefaultLockTimeout = 5 * time.Minute
+
+// lockPollInterval is the delay between two attempts to acquire a lock
+const lockPollInterval = 500 * time.Millisecond
+
+// ErrLockTimeout is returned when the migration lock could not be acquired in time
+var ErrLockTimeout = errors.New("timed out waiting for the migration lock")
+
+// locker guards migration runs against concurrent runs from other processes
+type locker interface {
+	// lock blocks until the lock is acquired, ctx is done or timeout elapses.
+	// A zero timeout waits until ctx is done.
+	lock(ctx context.Context, timeout time.Duration) error
+	// unlock releases the lock acquired by lock
+	unlock(ctx context.Context) error
+	// forceUnlock releases the lock regardless of which process holds it
+	forceUnlock(ctx context.Context) error
+}
+
+// newLocker returns the locker for the dialect, scoped to the given name
+func newLocker(db *sql.DB, dialect string, name string) (locker, error) {
+	switch dialect {
+	case DriverPostgres:
+		return &postgresLocker{db: db, key: lockKey(name)}, nil
+	case DriverMySQL:
+		return &mysqlLocker{db: db, name: name}, nil
+	case DriverSQLite:
+		return &sqliteLocker{db: db, table: name + "_lock"}, nil
+	default:
+		return nil, ErrUnsupportedDialect
+	}
+}
+
+// lockKey derives a positive advisory lock key from name
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("migration:" + name))
+	return int64(h.Sum64() & 0x7fffffffffffffff)
+}
+
+// lockOwner identifies the current process in lock records
+func lockOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// poll calls try until it reports success, ctx is done or timeout elapses
+func poll(ctx context.Context, timeout time.Duration, try func() (bool, error)) error {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+
+	for {
+		ok, err := try()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return ErrLockTimeout
+		case <-ticker.C:
+		}
+	}
+}
+
+// postgresLocker uses a session level advisory lock, which is held by the
+// connection it was taken on and released automatically if that session dies
+type postgresLocker struct {
+	db   *sql.DB
+	key  int64
+	conn *sql.Conn
+}
+
+func (l *postgresLocker) lock(ctx context.Context, timeout time.Duration) error {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = poll(ctx, timeout, func() (bool, error) {
+		var locked bool
+		err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&locked)
+		return locked, err
+	})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	l.conn = conn
+	return nil
+}
+
+func (l *postgresLocker) unlock(ctx context.Context) error {
+	if l.conn == nil {
+		return nil
+	}
+	defer func() {
+		l.conn.Close()
+		l.conn = nil
+	}()
+
+	_, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key)
+	return err
+}
+
+func (l *postgresLocker) forceUnlock(ctx context.Context) error {
+	// An advisory lock can only be released by its own session, so terminate
+	// the backend holding it. A bigint key is split into classid and objid.
+	_, err := l.db.ExecContext(ctx, `SELECT pg_terminate_backend(pid) FROM pg_locks
+		WHERE locktype = 'advisory' AND granted AND pid <> pg_backend_pid()
+		AND ((classid::bigint << 32) | objid::bigint) = $1`, l.key)
+	return err
+}
+
+// mysqlLocker uses a named user level lock, scoped to the current database
+// because GET_LOCK names are global to the server
+type mysqlLocker struct {
+	db   *sql.DB
+	name string
+	conn *sql.Conn
+}
+
+const mysqlLockName = "CONCAT(IFNULL(DATABASE(), ''), ':', ?)"
+
+func (l *mysqlLocker) lock(ctx context.Context, timeout time.Duration) error {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	// GET_LOCK waits on the server side, a negative timeout waits forever
+	seconds := -1
+	if timeout > 0 {
+		seconds = int((timeout + time.Second - 1) / time.Second)
+	}
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK("+mysqlLockName+", ?)", l.name, seconds).Scan(&locked); err != nil {
+		conn.Close()
+		return err
+	}
+
+	if !locked.Valid || locked.Int64 != 1 {
+		conn.Close()
+		return ErrLockTimeout
+	}
+
+	l.conn = conn
+	return nil
+}
+
+func (l *mysqlLocker) unlock(ctx context.Context) error {
+	if l.conn == nil {
+		return nil
+	}
+	defer func() {
+		l.conn.Close()
+		l.conn = nil
+	}()
+
+	_, err := l.conn.ExecContext(ctx, "SELECT RELEASE_LOCK("+mysqlLockName+")", l.name)
+	return err
+}
+
+func (l *mysqlLocker) forceUnlock(ctx context.Context) error {
+	// A user level lock can only be released by its own connection, so kill
+	// the connection holding it
+	var holder sql.NullInt64
+	if err := l.db.QueryRowContext(ctx, "SELECT IS_USED_LOCK("+mysqlLockName+")", l.name).Scan(&holder); err != nil {
+		return err
+	}
+
+	if !holder.Valid {
+		return nil
+	}
+
+	_, err := l.db.ExecContext(ctx, fmt.Sprintf("KILL %d", holder.Int64))
+	return err
+}
+
+// sqliteLocker stores the lock as a single row in a dedicated table, so a
+// crashed process leaves a stale lock behind that must be forced open
+type sqliteLocker struct {
+	db    *sql.DB
+	table string
+}
+
+func (l *sqliteLocker) lock(ctx context.Context, timeout time.Duration) error {
+	if _, err := l.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+l.table+` (
+		id INTEGER PRIMARY KEY,
+		locked_at TIMESTAMP,
+		locked_by VARCHAR(255)
+	);`); err != nil {
+		return err
+	}
+
+	owner := lockOwner()
+	return poll(ctx, timeout, func() (bool, error) {
+		_, err := l.db.ExecContext(ctx, "INSERT INTO "+l.table+" (id, locked_at, locked_by) VALUES (1, ?, ?)", time.Now().UTC(), owner)
+		if err == nil {
+			return true, nil
+		}
+
+		// The insert fails on the primary key while another process holds
+		// the lock, any other failure is reported as is
+		var held int
+		if qerr := l.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+l.table).Scan(&held); qerr != nil || held == 0 {
+			return false, err
+		}
+		return false, nil
+	})
+}
+
+func (l *sqliteLocker) unlock(ctx context.Context) error {
+	_, err := l.db.ExecContext(ctx, "DELETE FROM "+l.table+" WHERE id = 1")
+	return err
+}
+
+func (l *sqliteLocker) forceUnlock(ctx context.Context) error {
+	_, err := l.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+l.table)
+	return err
+}
+
+// ForceUnlock releases a migration lock left behind by another process, for
+// example one that crashed while running migrations
+func (m *Migrator) ForceUnlock() error {
+	return m.ForceUnlockContext(context.Background())
+}
+
+// ForceUnlockContext is like ForceUnlock but takes a context
+func (m *Migrator) ForceUnlockContext(ctx context.Context) error {
+	return m.locker.forceUnlock(ctx)
+}
+
+// lock acquires the migration lock and returns the function releasing it
+func (m *Migrator) lock(ctx context.Context) (func() error, error) {
+	if err := m.locker.lock(ctx, m.lockTimeout); err != nil {
+		if errors.Is(err, ErrLockTimeout) {
+			return nil, fmt.Errorf("%w after %s, another process may be running migrations (use `migrate unlock` to release a stale lock)", err, m.lockTimeout)
+		}
+		return nil, err
+	}
+
+	return func() error {
+		// Release the lock even if the run was cancelled
+		return m.locker.unlock(context.WithoutCancel(ctx))
+	}, nil
+}
@@ -0,0 +1,93 @@
+package migration
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Logger receives the messages of the package, with alternating key and
+// value arguments. *slog.Logger satisfies it.
+type Logger interface {
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+var (
+	loggerMu      sync.RWMutex
+	defaultLogger Logger = NewTextLogger(os.Stderr)
+)
+
+// SetLogger replaces the logger used by the package functions, and by the
+// Migrators created without WithLogger. It writes to stderr by default.
+func SetLogger(l Logger) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	defaultLogger = l
+}
+
+// logger returns the logger set with SetLogger
+func logger() Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return defaultLogger
+}
+
+// log returns the logger of the Migrator
+func (m *Migrator) log() Logger {
+	if m.logger != nil {
+		return m.logger
+	}
+	return logger()
+}
+
+// NewTextLogger returns a Logger writing one line per message to w, e.g.
+// "Running migration version=20220729200658"
+func NewTextLogger(w io.Writer) Logger {
+	return &textLogger{w: w}
+}
+
+// NopLogger returns a Logger discarding every message
+func NopLogger() Logger {
+	return NewTextLogger(io.Discard)
+}
+
+type textLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *textLogger) Info(msg string, args ...any) {
+	l.write("", msg, args)
+}
+
+func (l *textLogger) Warn(msg string, args ...any) {
+	l.write("Warning: ", msg, args)
+}
+
+func (l *textLogger) Error(msg string, args ...any) {
+	l.write("Error: ", msg, args)
+}
+
+func (l *textLogger) write(prefix string, msg string, args []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.w, prefix+formatMessage(msg, args))
+}
+
+// formatMessage appends the key=value pairs of args to msg
+func formatMessage(msg string, args []any) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", args[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,35 @@
+package migration
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestWithLoggerAcceptsSlog(t *testing.T) {
+	var buf bytes.Buffer
+	m := newTestMigrator(t, createTableMigration("20240101000000", "users"))
+	WithLogger(slog.New(slog.NewTextHandler(&buf, nil)))(m)
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if !strings.Contains(buf.String(), `msg="Running migration" version=20240101000000`) {
+		t.Errorf("Expected the run to be logged, got %s", buf.String())
+	}
+}
+
+func TestTextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewTextLogger(&buf)
+
+	l.Info("Running migration", "version", "20240101000000")
+	l.Warn("Careful")
+
+	expected := "Running migration version=20240101000000\nWarning: Careful\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
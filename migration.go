@@ -10,6 +10,7 @@ import (
 	"html/template"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -18,10 +19,14 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// DefaultTableName is the name of the table recording applied migrations
+const DefaultTableName = "schema_migrations"
+
 //go:embed template.txt
 var stub string
 
-var dbDialect string
+//go:embed template_notx.txt
+var noTxStub string
 
 // Migration represents a migration data type
 type Migration struct {
@@ -29,247 +34,839 @@ type Migration struct {
 	Up      func(*sql.Tx) error
 	Down    func(*sql.Tx) error
 
-	done bool
+	// Name is the descriptive part of the migration's file name, if known
+	Name string
+
+	// Checksum is stored when the migration is applied, so Validate can tell
+	// if the migration was edited afterwards. SQL migrations get the hash of
+	// their up file, Go migrations may set any value that changes with them.
+	Checksum string
+
+	// UpContext and DownContext take precedence over Up and Down when set.
+	// They receive the context passed to Migrator.UpContext/DownContext so
+	// long running data migrations can observe cancellation.
+	UpContext   func(context.Context, *sql.Tx) error
+	DownContext func(context.Context, *sql.Tx) error
+
+	// NoTx marks statements that cannot run inside a transaction, such as
+	// CREATE INDEX CONCURRENTLY on Postgres. UpDB and DownDB are then called
+	// outside any transaction and the migration is recorded separately.
+	NoTx   bool
+	UpDB   func(*sql.DB) error
+	DownDB func(*sql.DB) error
+
+	// UpDBContext and DownDBContext take precedence over UpDB and DownDB
+	// when set, and receive the context of the run like UpContext
+	UpDBContext   func(context.Context, *sql.DB) error
+	DownDBContext func(context.Context, *sql.DB) error
+
+	// Environments lists the environments the migration runs in, such as
+	// "dev" or "prod", see Migrator.Environment. Up skips it elsewhere and
+	// it stays pending. A migration without Environments runs everywhere.
+	Environments []string
+
+	// Squashes lists the older versions replaced by this migration, a
+	// snapshot written by Migrator.Squash. Databases which applied them
+	// skip the snapshot, and reverting it forgets them too.
+	Squashes []string
+
+	// Snapshot marks a migration written by Migrator.Squash. The databases
+	// migrated before the squash recorded the checksum of the migration it
+	// replaced under the same version, one of SquashedChecksums.
+	Snapshot          bool
+	SquashedChecksums []string
+}
+
+// Direction tells whether a migration is being applied or reverted
+type Direction string
+
+const (
+	DirectionUp   Direction = "up"
+	DirectionDown Direction = "down"
+)
+
+// TxMode controls how the migrations of a run are wrapped in transactions
+type TxMode int
+
+const (
+	// TxSingle runs all migrations of a run in one transaction, so either
+	// all of them are applied or none is
+	TxSingle TxMode = iota
+	// TxPerMigration runs and records each migration in its own transaction,
+	// so the migrations preceding a failure stay applied
+	TxPerMigration
+)
+
+// ParseTxMode parses "single" or "per-migration" into a TxMode
+func ParseTxMode(mode string) (TxMode, error) {
+	switch mode {
+	case "single":
+		return TxSingle, nil
+	case "per-migration":
+		return TxPerMigration, nil
+	default:
+		return TxSingle, fmt.Errorf("unknown transaction mode %q, expected \"single\" or \"per-migration\"", mode)
+	}
+}
+
+// MigrationError reports the migration a run failed on
+type MigrationError struct {
+	Version   string
+	Direction Direction
+	// Committed is the number of migrations of the run that were committed
+	// before the failure. In TxSingle mode it is zero unless a NoTx migration
+	// forced the preceding ones to be committed.
+	Committed int
+	Err       error
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("migration %s failed (%s), %d version(s) already committed: %s", e.Version, e.Direction, e.Committed, e.Err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// DirtyError reports migrations whose run was interrupted halfway, leaving
+// the database in an unknown state
+type DirtyError struct {
+	Versions []string
+}
+
+func (e *DirtyError) Error() string {
+	return fmt.Sprintf("the database is dirty, migration(s) %s were interrupted: fix the schema by hand, then mark them as applied with force or as not applied with unapply, or run repair to forget the interrupted step once the schema is reverted by hand",
+		strings.Join(e.Versions, ", "))
+}
+
+// OutOfOrderError reports pending migrations older than the newest applied
+// one, usually merged from another branch, see WithAllowOutOfOrder
+type OutOfOrderError struct {
+	Versions      []string
+	LatestApplied string
+}
+
+func (e *OutOfOrderError) Error() string {
+	return fmt.Sprintf("pending migration(s) %s are older than the latest applied migration %s (allow out of order migrations to apply them)",
+		strings.Join(e.Versions, ", "), e.LatestApplied)
+}
+
+// up runs the forward migration, preferring UpContext over Up
+func (mg *Migration) up(ctx context.Context, tx *sql.Tx) error {
+	if mg.UpContext != nil {
+		return mg.UpContext(ctx, tx)
+	}
+	if mg.Up != nil {
+		return mg.Up(tx)
+	}
+	return nil
+}
+
+// down runs the backward migration, preferring DownContext over Down
+func (mg *Migration) down(ctx context.Context, tx *sql.Tx) error {
+	if mg.DownContext != nil {
+		return mg.DownContext(ctx, tx)
+	}
+	if mg.Down != nil {
+		return mg.Down(tx)
+	}
+	return nil
+}
+
+// upDB runs the forward migration of a NoTx migration, preferring
+// UpDBContext over UpDB
+func (mg *Migration) upDB(ctx context.Context, db *sql.DB) error {
+	if mg.UpDBContext != nil {
+		return mg.UpDBContext(ctx, db)
+	}
+	if mg.UpDB != nil {
+		return mg.UpDB(db)
+	}
+	return nil
+}
+
+// downDB runs the backward migration of a NoTx migration, preferring
+// DownDBContext over DownDB
+func (mg *Migration) downDB(ctx context.Context, db *sql.DB) error {
+	if mg.DownDBContext != nil {
+		return mg.DownDBContext(ctx, db)
+	}
+	if mg.DownDB != nil {
+		return mg.DownDB(db)
+	}
+	return nil
+}
+
+// matchesChecksum reports whether a database which recorded the given
+// checksum applied this migration as it is, or the migration a snapshot
+// replaced before the squash
+func (mg *Migration) matchesChecksum(applied string) bool {
+	return applied == mg.Checksum || mg.Snapshot && slices.Contains(mg.SquashedChecksums, applied)
 }
 
 // Migrator is a struct that holds the migrations
 type Migrator struct {
-	db         *sql.DB
-	Versions   []string
-	Migrations map[string]*Migration
+	*Registry
+
+	db      *sql.DB
+	dialect string
+
+	locker      locker
+	lockTimeout time.Duration
+	txMode      TxMode
+
+	allowOutOfOrder bool
+
+	// environment is set with WithEnvironment, see Environment
+	environment string
+
+	// migrationsDir is set with WithMigrationsDir, see MigrationsDir
+	migrationsDir string
+
+	// readOnly is set with WithReadOnly
+	readOnly bool
+
+	tableName string
+	schema    string
+
+	// history holds the rows of the migrations table keyed by version
+	history map[string]*historyRecord
+
+	// recorder captures the statements of a dry run, see Plan
+	recorder *recorder
+
+	logger Logger
+
+	hooks hooks
 }
 
-var migrator = &Migrator{
-	Versions:   []string{},
-	Migrations: map[string]*Migration{},
+// newMigrator returns a Migrator with an empty registry and default settings
+func newMigrator() *Migrator {
+	return &Migrator{
+		Registry:    NewRegistry(),
+		lockTimeout: DefaultLockTimeout,
+		tableName:   DefaultTableName,
+		history:     map[string]*historyRecord{},
+	}
 }
 
-// GetMigrator returns the migrator
+// migrator is the default instance returned by GetMigrator
+var migrator = newMigrator()
+
+// GetMigrator returns the default migrator, which migrations registered from
+// init functions are usually added to. Use New for independent migrators.
 func GetMigrator() *Migrator {
 	return migrator
 }
 
-// AddMigration adds a migration to the migrator
-func (m *Migrator) AddMigration(mg *Migration) {
-	// Add the migration to the hash with version as key
-	m.Migrations[mg.Version] = mg
-
-	// Insert version into versions array using insertion sort
-	index := 0
-	for index < len(m.Versions) {
-		if m.Versions[index] > mg.Version {
-			break
-		}
-		index++
+// Init populates the fields of the default Migrator and returns it
+func Init(db *sql.DB, dialect string, opts ...Option) (*Migrator, error) {
+	if err := migrator.init(db, dialect, opts...); err != nil {
+		return migrator, err
 	}
+	return migrator, nil
+}
 
-	m.Versions = append(m.Versions, mg.Version)
-	copy(m.Versions[index+1:], m.Versions[index:])
-	m.Versions[index] = mg.Version
+// New returns a Migrator for db that is independent of the default one and
+// of any other, with its own registry. Use WithRegistry to populate it with
+// the migrations of a Registry.
+func New(db *sql.DB, dialect string, opts ...Option) (*Migrator, error) {
+	m := newMigrator()
+	if err := m.init(db, dialect, opts...); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
-// Init populates the fields of Migrator and returns it
-func Init(db *sql.DB, dialect string) (*Migrator, error) {
+// init applies the options, then prepares the migrations table and reads
+// which migrations were applied
+func (m *Migrator) init(db *sql.DB, dialect string, opts ...Option) error {
 	if dialect != DriverSQLite && dialect != DriverMySQL && dialect != DriverPostgres {
-		return nil, errors.New("unsupported driver")
+		return errors.New("unsupported driver")
 	}
 
-	dbDialect = dialect
-	migrator.db = db
+	m.db = db
+	m.dialect = dialect
 
-	// Create `schema_migrations` table to remember which migrations were executed.
-	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
-		version varchar(255),
-		batch int
-	);`); err != nil {
-		fmt.Println("Unable to create `schema_migrations` table", err)
-		return migrator, err
+	for _, opt := range opts {
+		opt(m)
 	}
 
-	// Find out all the executed migrations
-	rows, err := db.Query("SELECT version FROM schema_migrations;")
-	if err != nil {
-		return migrator, err
+	if !identifierPattern.MatchString(m.tableName) {
+		return fmt.Errorf("invalid migrations table name %q", m.tableName)
+	}
+	if m.schema != "" && !identifierPattern.MatchString(m.schema) {
+		return fmt.Errorf("invalid migrations schema name %q", m.schema)
 	}
 
-	defer rows.Close()
+	l, err := newLocker(db, dialect, m.table())
+	if err != nil {
+		return err
+	}
+	m.locker = l
 
-	// Mark the migrations as Done if it is already executed
-	for rows.Next() {
-		var version string
-		err := rows.Scan(&version)
-		if err != nil {
-			return migrator, err
+	if !m.readOnly {
+		if err := m.prepareTable(context.Background()); err != nil {
+			return fmt.Errorf("unable to create `%s` table: %w", m.table(), err)
 		}
+	}
 
-		if migrator.Migrations[version] != nil {
-			migrator.Migrations[version].done = true
-		}
+	return m.loadApplied(context.Background())
+}
+
+// prepareTable creates or upgrades the migrations table if needed. Several
+// processes may start at once, e.g. replicas calling Init, so the changes
+// are made holding the lock.
+func (m *Migrator) prepareTable(ctx context.Context) (err error) {
+	if m.tableReady(ctx) {
+		return nil
+	}
+
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
 	}
+	defer func() {
+		err = errors.Join(err, unlock())
+	}()
 
-	return migrator, err
+	return m.ensureTable(ctx, m.db)
 }
 
 // Up method runs the migrations which have not yet been run
 func (m *Migrator) Up(step int) error {
-	var bindPlaceHolders string
-	if dbDialect == DriverMySQL || dbDialect == DriverSQLite {
-		bindPlaceHolders = "?, ?"
-	} else if dbDialect == DriverPostgres {
-		bindPlaceHolders = "$1, $2"
-	} else {
-		return errors.New("unsupported driver")
+	return m.UpContext(context.Background(), step)
+}
+
+// UpContext runs the migrations which have not yet been run. The run is
+// aborted and rolled back when ctx is cancelled or its deadline expires.
+func (m *Migrator) UpContext(ctx context.Context, step int) error {
+	return m.withLock(ctx, func() error {
+		return m.up(ctx, step)
+	})
+}
+
+// up runs the pending migrations, the lock being held
+func (m *Migrator) up(ctx context.Context, step int) error {
+	if err := m.checkDirty(); err != nil {
+		return err
+	}
+
+	lastBatch, err := m.lastBatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	pending, err := m.checkedPending(step)
+	if err != nil {
+		return err
+	}
+
+	return m.run(ctx, DirectionUp, pending, lastBatch+1)
+}
+
+// checkedPending returns the migrations Up would run, failing like Up does
+// when some of them are out of order or replace applied migrations
+func (m *Migrator) checkedPending(step int) ([]*Migration, error) {
+	pending := m.pending(step)
+	if err := m.checkOrder(pending, m.latestApplied()); err != nil {
+		return nil, err
+	}
+	if err := m.checkSquashes(pending); err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// checkOrder returns an *OutOfOrderError if some of the given pending
+// migrations are older than latest, the newest applied version, unless out
+// of order migrations are allowed
+func (m *Migrator) checkOrder(pending []*Migration, latest string) error {
+	if m.allowOutOfOrder {
+		return nil
+	}
+
+	versions := []string{}
+	for _, mg := range pending {
+		if mg.Version < latest {
+			versions = append(versions, mg.Version)
+		}
+	}
+	if len(versions) > 0 {
+		return &OutOfOrderError{Versions: versions, LatestApplied: latest}
+	}
+	return nil
+}
+
+// outOfOrder reports whether version is pending and older than the newest
+// applied migration
+func (m *Migrator) outOfOrder(version string) bool {
+	return !m.applied(version) && m.runsHere(m.Migrations[version]) && version < m.latestApplied()
+}
+
+// runsHere reports whether the migration is meant for the Migrator's
+// environment
+func (m *Migrator) runsHere(mg *Migration) bool {
+	return inEnvironment(mg.Environments, m.Environment())
+}
+
+// latestApplied returns the newest applied version, or an empty string
+func (m *Migrator) latestApplied() string {
+	latest := ""
+	for version := range m.history {
+		latest = max(latest, version)
 	}
+	return latest
+}
+
+// Environment returns the environment the Migrator runs in, set with
+// WithEnvironment or else taken from the APP_ENV env variable
+func (m *Migrator) Environment() string {
+	if m.environment != "" {
+		return m.environment
+	}
+	return os.Getenv("APP_ENV")
+}
+
+// IsProduction reports whether the Migrator runs in production, that is
+// in the "prod" or "production" environment
+func (m *Migrator) IsProduction() bool {
+	return IsProduction(m.Environment())
+}
 
-	// Use background context for transaction
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// IsProduction reports whether env names the production environment
+func IsProduction(env string) bool {
+	env = strings.ToLower(env)
+	return env == "prod" || env == "production"
+}
 
-	tx, err := m.db.BeginTx(ctx, &sql.TxOptions{})
+// inEnvironment reports whether env is one of envs. An empty list matches
+// every environment.
+func inEnvironment(envs []string, env string) bool {
+	return len(envs) == 0 || slices.Contains(envs, env)
+}
+
+// withLock runs fn while holding the migration lock, with the applied
+// migrations freshly loaded
+func (m *Migrator) withLock(ctx context.Context, fn func() error) (err error) {
+	if m.readOnly {
+		return errors.New("the migrator is read-only, see WithReadOnly")
+	}
+
+	unlock, err := m.lock(ctx)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		err = errors.Join(err, unlock())
+	}()
 
-	count := 0
-	lastBatch := 0
-	if rows, err := m.db.Query("SELECT MAX(batch) FROM schema_migrations;"); err != nil {
+	// Another process may have run migrations while we waited for the lock
+	if err := m.loadApplied(ctx); err != nil {
 		return err
-	} else {
-		defer rows.Close()
-		for rows.Next() {
-			var lastBatchPtr *int // use a pointer to int to allow for NULL values
-			if err := rows.Scan(&lastBatchPtr); err != nil {
-				return err
-			}
-			if lastBatchPtr != nil {
-				lastBatch = *lastBatchPtr // dereference the pointer to get the actual value
-			}
+	}
+
+	return fn()
+}
+
+// checkDirty returns a *DirtyError if some migrations are dirty
+func (m *Migrator) checkDirty() error {
+	versions := []string{}
+	for v, record := range m.history {
+		if record.dirty != "" {
+			versions = append(versions, v)
 		}
 	}
+	slices.Sort(versions)
 
+	if len(versions) > 0 {
+		return &DirtyError{Versions: versions}
+	}
+	return nil
+}
+
+// pending returns the migrations which have not yet been run, at most step
+// of them when step is positive
+func (m *Migrator) pending(step int) []*Migration {
+	pending := []*Migration{}
 	for _, v := range m.Versions {
-		if step > 0 && count == step {
+		if step > 0 && len(pending) == step {
 			break
 		}
 
-		mg := m.Migrations[v]
-		if mg.done {
-			continue
+		if !m.applied(v) && m.runsHere(m.Migrations[v]) {
+			pending = append(pending, m.Migrations[v])
 		}
+	}
+	return pending
+}
 
-		fmt.Println("Running migration", mg.Version)
-		if err := mg.Up(tx); err != nil {
-			tx.Rollback()
+// Down migration rolls back the last step+1 batches of migrations.
+//
+// Deprecated: use DownBatches or DownSteps, which count from 1.
+func (m *Migrator) Down(step int) error {
+	return m.DownContext(context.Background(), step)
+}
+
+// DownContext rolls back the last step+1 batches of migrations. The run is
+// aborted and rolled back when ctx is cancelled or its deadline expires.
+//
+// Deprecated: use DownBatchesContext or DownStepsContext, which count from 1.
+func (m *Migrator) DownContext(ctx context.Context, step int) error {
+	return m.DownBatchesContext(ctx, step+1)
+}
+
+// DownBatches rolls back the migrations of the last n batches, at least one
+func (m *Migrator) DownBatches(n int) error {
+	return m.DownBatchesContext(context.Background(), n)
+}
+
+// DownBatchesContext rolls back the migrations of the last n batches, at
+// least one, newest version first. The run is aborted and rolled back when
+// ctx is cancelled or its deadline expires.
+func (m *Migrator) DownBatchesContext(ctx context.Context, n int) error {
+	return m.withLock(ctx, func() error {
+		if err := m.checkDirty(); err != nil {
 			return err
 		}
 
-		if _, err := tx.Exec("INSERT INTO schema_migrations VALUES("+bindPlaceHolders+")", mg.Version, lastBatch+1); err != nil {
-			tx.Rollback()
+		applied, err := m.lastBatches(ctx, n)
+		if err != nil {
 			return err
 		}
-		fmt.Println("Finished running migration", mg.Version)
-
-		count++
-	}
 
-	tx.Commit()
+		return m.run(ctx, DirectionDown, applied, 0)
+	})
+}
 
-	return nil
+// DownSteps rolls back the last n applied migrations, at least one
+func (m *Migrator) DownSteps(n int) error {
+	return m.DownStepsContext(context.Background(), n)
 }
 
-// Down migration rolls back the last batch of migrations
-func (m *Migrator) Down(step int) error {
-	var bindPlaceHolder string
-	switch dbDialect {
-	case DriverMySQL, DriverSQLite:
-		bindPlaceHolder = "?"
-	case DriverPostgres:
-		bindPlaceHolder = "$1"
-	default:
-		return errors.New("unsupported driver")
-	}
+// DownStepsContext rolls back the last n applied migrations, at least one,
+// in reverse version order regardless of their batch. The run is aborted
+// and rolled back when ctx is cancelled or its deadline expires.
+func (m *Migrator) DownStepsContext(ctx context.Context, n int) error {
+	return m.withLock(ctx, func() error {
+		if err := m.checkDirty(); err != nil {
+			return err
+		}
 
-	// Use background context for transaction
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+		applied, err := m.lastSteps(n)
+		if err != nil {
+			return err
+		}
 
-	tx, err := m.db.BeginTx(ctx, &sql.TxOptions{})
-	if err != nil {
-		return err
-	}
+		return m.run(ctx, DirectionDown, applied, 0)
+	})
+}
 
-	// Reverse the migration based on the batch column and the step passed
+// lastBatches returns the migrations of the last n batches, at least one,
+// newest first
+func (m *Migrator) lastBatches(ctx context.Context, n int) ([]*Migration, error) {
+	if n < 1 {
+		n = 1
+	}
 
-	rows, err := m.db.Query(
-		fmt.Sprintf(`SELECT version FROM schema_migrations WHERE batch BETWEEN (SELECT MAX(batch - %s) FROM schema_migrations) AND (SELECT MAX(batch) FROM schema_migrations) ORDER BY version DESC;`, bindPlaceHolder),
-		step,
+	rows, err := m.db.QueryContext(
+		ctx,
+		fmt.Sprintf(`SELECT version FROM %[1]s WHERE batch BETWEEN (SELECT MAX(batch - %[2]s) FROM %[1]s) AND (SELECT MAX(batch) FROM %[1]s) ORDER BY version DESC;`, m.table(), m.bindVars(1)),
+		n-1,
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer rows.Close()
 
-	var version string
+	squashed := m.squashedVersions()
+	applied := []*Migration{}
 	for rows.Next() {
-		err := rows.Scan(&version)
-		if err != nil {
-			return err
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		// Reverted along with their snapshot
+		if squashed[version] != nil {
+			continue
 		}
 
 		mg := m.Migrations[version]
-		if !mg.done {
-			return errors.New("migration not found")
+		if mg == nil {
+			return nil, fmt.Errorf("migration %s not found", version)
 		}
+		applied = append(applied, mg)
+	}
+	return applied, rows.Err()
+}
 
-		fmt.Println("Reverting Migration", mg.Version)
-		if err := mg.Down(tx); err != nil {
-			tx.Rollback()
-			return err
+// lastSteps returns the last n applied migrations, at least one, newest first
+func (m *Migrator) lastSteps(n int) ([]*Migration, error) {
+	if n < 1 {
+		n = 1
+	}
+
+	squashed := m.squashedVersions()
+	versions := make([]string, 0, len(m.history))
+	for version := range m.history {
+		if squashed[version] == nil {
+			versions = append(versions, version)
+		}
+	}
+	slices.Sort(versions)
+	versions = reverse(versions)[:min(n, len(versions))]
+
+	applied := []*Migration{}
+	for _, version := range versions {
+		mg := m.Migrations[version]
+		if mg == nil {
+			return nil, fmt.Errorf("migration %s not found", version)
 		}
+		applied = append(applied, mg)
+	}
+	return applied, nil
+}
 
-		if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = "+bindPlaceHolder, mg.Version); err != nil {
+// run applies or reverts the given migrations in order, wrapping them in
+// transactions according to the migrator's TxMode. Applied migrations are
+// recorded with the given batch number.
+func (m *Migrator) run(ctx context.Context, direction Direction, migrations []*Migration, batch int) error {
+	var tx *sql.Tx
+	pending := 0 // migrations executed in tx but not committed yet
+	committed := 0
+
+	fail := func(mg *Migration, err error) error {
+		if tx != nil {
 			tx.Rollback()
+		}
+		return &MigrationError{Version: mg.Version, Direction: direction, Committed: committed, Err: err}
+	}
+
+	commit := func() error {
+		err := tx.Commit()
+		tx = nil
+		if err != nil {
 			return err
 		}
-		fmt.Println("Finished reverting migration", mg.Version)
+		committed += pending
+		pending = 0
+		return nil
+	}
+
+	if len(migrations) == 0 {
+		return nil
 	}
 
-	tx.Commit()
+	if err := runHooks(ctx, m.hooks.beforeAll, m.db, nil, direction); err != nil {
+		return fail(migrations[0], err)
+	}
 
-	return nil
-}
+	for _, mg := range migrations {
+		if err := ctx.Err(); err != nil {
+			return fail(mg, err)
+		}
 
-// Status checks which migrations have run and which have not
-func (m *Migrator) MigrationStatus() error {
-	for _, v := range m.Versions {
-		mg := m.Migrations[v]
+		if mg.NoTx {
+			// Statements that refuse to run in a transaction can't be
+			// rolled back together with the preceding migrations
+			if tx != nil {
+				if err := commit(); err != nil {
+					return fail(mg, err)
+				}
+			}
+
+			if err := m.runNoTx(ctx, direction, mg, batch); err != nil {
+				return fail(mg, err)
+			}
+			committed++
+			continue
+		}
+
+		if tx == nil {
+			var err error
+			if tx, err = m.db.BeginTx(ctx, &sql.TxOptions{}); err != nil {
+				return fail(mg, err)
+			}
+		}
+
+		if err := runHooks(ctx, m.hooks.beforeEach, tx, mg, direction); err != nil {
+			return fail(mg, err)
+		}
+
+		if m.tracksDirty(mg) {
+			if err := m.markDirty(ctx, mg, direction, batch); err != nil {
+				return fail(mg, err)
+			}
+		}
+
+		if direction == DirectionUp {
+			m.progress("Running migration", "version", mg.Version)
+			start := time.Now()
+			if err := mg.up(ctx, tx); err != nil {
+				return fail(mg, err)
+			}
 
-		if mg.done {
-			fmt.Println(fmt.Sprintf("Migration %s... completed", v))
+			if err := m.finishUp(ctx, tx, mg, batch, time.Since(start)); err != nil {
+				return fail(mg, err)
+			}
+			m.progress("Finished running migration", "version", mg.Version)
 		} else {
-			fmt.Println(fmt.Sprintf("Migration %s... pending", v))
+			m.progress("Reverting migration", "version", mg.Version)
+			if err := mg.down(ctx, tx); err != nil {
+				return fail(mg, err)
+			}
+
+			if err := m.recordDown(ctx, tx, mg); err != nil {
+				return fail(mg, err)
+			}
+			m.progress("Finished reverting migration", "version", mg.Version)
+		}
+
+		if err := runHooks(ctx, m.hooks.afterEach, tx, mg, direction); err != nil {
+			return fail(mg, err)
+		}
+		pending++
+
+		if m.txMode == TxPerMigration {
+			if err := commit(); err != nil {
+				return fail(mg, err)
+			}
 		}
 	}
 
+	last := migrations[len(migrations)-1]
+	if tx != nil {
+		if err := commit(); err != nil {
+			return &MigrationError{Version: last.Version, Direction: direction, Committed: committed, Err: err}
+		}
+	}
+
+	if err := runHooks(ctx, m.hooks.afterAll, m.db, nil, direction); err != nil {
+		return &MigrationError{Version: last.Version, Direction: direction, Committed: committed, Err: err}
+	}
+
 	return nil
 }
 
+// runNoTx applies or reverts a NoTx migration directly on the database
+func (m *Migrator) runNoTx(ctx context.Context, direction Direction, mg *Migration, batch int) error {
+	if err := runHooks(ctx, m.hooks.beforeEach, m.db, mg, direction); err != nil {
+		return err
+	}
+
+	if err := m.markDirty(ctx, mg, direction, batch); err != nil {
+		return err
+	}
+
+	if direction == DirectionUp {
+		m.progress("Running migration", "version", mg.Version, "transaction", false)
+		start := time.Now()
+		if err := mg.upDB(ctx, m.db); err != nil {
+			return err
+		}
+
+		if err := m.finishUp(ctx, m.db, mg, batch, time.Since(start)); err != nil {
+			return err
+		}
+		m.progress("Finished running migration", "version", mg.Version)
+	} else {
+		m.progress("Reverting migration", "version", mg.Version, "transaction", false)
+		if err := mg.downDB(ctx, m.db); err != nil {
+			return err
+		}
+
+		if err := m.recordDown(ctx, m.db, mg); err != nil {
+			return err
+		}
+		m.progress("Finished reverting migration", "version", mg.Version)
+	}
+
+	return runHooks(ctx, m.hooks.afterEach, m.db, mg, direction)
+}
+
+// progress reports the progress of a run. During a dry run it is added to
+// the plan as a comment.
+func (m *Migrator) progress(msg string, args ...any) {
+	if m.recorder != nil {
+		m.recorder.comment(formatMessage(msg, args))
+		return
+	}
+	m.log().Info(msg, args...)
+}
+
+// bindVars returns n comma separated bind placeholders for the dialect
+func (m *Migrator) bindVars(n int) string {
+	vars := make([]string, n)
+	for i := range vars {
+		vars[i] = m.bindVar(i + 1)
+	}
+	return strings.Join(vars, ", ")
+}
+
+// bindVar returns the bind placeholder of the i-th argument, from 1
+func (m *Migrator) bindVar(i int) string {
+	if m.dialect == DriverPostgres {
+		return fmt.Sprintf("$%d", i)
+	}
+	return "?"
+}
+
 // guessPackageNameFromMigrationsDir guesses the package name from a given migrations dir path.
 func guessPackageNameFromMigrationsDir(migrationsDir string) string {
 	splitPath := strings.Split(migrationsDir, "/")
 	return splitPath[len(splitPath)-1]
 }
 
-// CreateMigration creates a migration file
-func CreateMigration(name string) error {
-	migrationsDir := os.Getenv("MIGRATIONS_DIR")
+// CreateMigration creates a migration file in the directory dir
+func CreateMigration(dir string, name string) error {
+	return createMigrationFile(dir, name, stub)
+}
 
-	if migrationsDir != "" {
-		migrationsDir = strings.TrimSuffix(migrationsDir, "/")
-	} else {
-		migrationsDir = "./cmd/migrations"
+// CreateNoTxMigration creates a migration file in the directory dir for
+// statements that cannot run inside a transaction
+func CreateNoTxMigration(dir string, name string) error {
+	return createMigrationFile(dir, name, noTxStub)
+}
+
+// DefaultMigrationsDir is the directory of the migration files when the
+// MIGRATIONS_DIR env variable is not set
+const DefaultMigrationsDir = "./cmd/migrations"
+
+// MigrationsDir returns the directory migration files are generated in and
+// loaded from, taken from the MIGRATIONS_DIR env variable
+func MigrationsDir() string {
+	if migrationsDir := os.Getenv("MIGRATIONS_DIR"); migrationsDir != "" {
+		return strings.TrimSuffix(migrationsDir, "/")
+	}
+	return DefaultMigrationsDir
+}
+
+// MigrationsDir returns the directory set with WithMigrationsDir, or else
+// the package level MigrationsDir
+func (m *Migrator) MigrationsDir() string {
+	if m.migrationsDir != "" {
+		return m.migrationsDir
+	}
+	return MigrationsDir()
+}
+
+// makeMigrationsDir creates the migrations directory if needed and returns its path
+func makeMigrationsDir(migrationsDir string) (string, error) {
+	wd, _ := os.Getwd()
+	path := filepath.Join(wd, migrationsDir)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.MkdirAll(path, os.ModePerm); err != nil {
+			return "", errors.New("Unable to create migrations directory:" + err.Error())
+		}
 	}
+	return path, nil
+}
+
+// createMigrationFile renders the given template into a new migration file
+// in the directory migrationsDir
+func createMigrationFile(migrationsDir string, name string, tmpl string) error {
+	migrationsDir = strings.TrimSuffix(migrationsDir, "/")
 
 	packageName := guessPackageNameFromMigrationsDir(migrationsDir)
 
@@ -287,17 +884,14 @@ func CreateMigration(name string) error {
 
 	var out bytes.Buffer
 	tx := template.New("template")
-	t := template.Must(tx.Parse(stub))
+	t := template.Must(tx.Parse(tmpl))
 	err := t.Execute(&out, in)
 	if err != nil {
 		return errors.New("Unable to execute template:" + err.Error())
 	}
-	wd, _ := os.Getwd()
-	path := filepath.Join(wd, migrationsDir)
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		if err := os.MkdirAll(path, os.ModePerm); err != nil {
-			return errors.New("Unable to create migrations directory:" + err.Error())
-		}
+	path, err := makeMigrationsDir(migrationsDir)
+	if err != nil {
+		return err
 	}
 	f, err := os.Create(fmt.Sprintf("%s/%s_%s.go", path, version, name))
 	if err != nil {
@@ -309,7 +903,7 @@ func CreateMigration(name string) error {
 		return errors.New("Unable to write to migration file:" + err.Error())
 	}
 
-	fmt.Println("Generated new migration files...", f.Name())
+	logger().Info("Generated new migration file", "path", f.Name())
 	return nil
 }
 
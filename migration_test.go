@@ -0,0 +1,421 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestDB opens a fresh SQLite database in a temporary directory
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open(DriverSQLite, "file:"+filepath.Join(t.TempDir(), "test.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatalf("Unable to open database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// newTestMigrator returns a Migrator with the given migrations registered,
+// initialized against a fresh SQLite database
+func newTestMigrator(t *testing.T, migrations ...*Migration) *Migrator {
+	t.Helper()
+
+	r := NewRegistry()
+	for _, mg := range migrations {
+		r.AddMigration(mg)
+	}
+
+	m, err := New(newTestDB(t), DriverSQLite, WithRegistry(r), WithLogger(NopLogger()))
+	if err != nil {
+		t.Fatalf("Unable to init migrator: %s", err)
+	}
+
+	return m
+}
+
+// createTableMigration returns a migration that creates and drops the given table
+func createTableMigration(version string, table string) *Migration {
+	return &Migration{
+		Version: version,
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec("CREATE TABLE " + table + " (id INTEGER)")
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec("DROP TABLE " + table)
+			return err
+		},
+	}
+}
+
+// appliedVersions returns the versions recorded in schema_migrations
+func appliedVersions(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+
+	rows, err := db.Query("SELECT version FROM schema_migrations ORDER BY version")
+	if err != nil {
+		t.Fatalf("Unable to query schema_migrations: %s", err)
+	}
+	defer rows.Close()
+
+	versions := []string{}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			t.Fatalf("Unable to scan version: %s", err)
+		}
+		versions = append(versions, version)
+	}
+
+	return versions
+}
+
+func TestUpAndDown(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		createTableMigration("20240102000000", "posts"),
+	)
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if got := appliedVersions(t, m.db); len(got) != 2 {
+		t.Fatalf("Expected 2 applied versions, got %v", got)
+	}
+
+	if err := m.Down(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if got := appliedVersions(t, m.db); len(got) != 0 {
+		t.Errorf("Expected no applied versions, got %v", got)
+	}
+}
+
+func TestUpContextPassesContextToMigration(t *testing.T) {
+	type key struct{}
+	var got any
+
+	m := newTestMigrator(t, &Migration{
+		Version: "20240101000000",
+		UpContext: func(ctx context.Context, tx *sql.Tx) error {
+			got = ctx.Value(key{})
+			return nil
+		},
+	})
+
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	if err := m.UpContext(ctx, 0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if got != "value" {
+		t.Errorf("Expected migration to receive the caller's context, got %v", got)
+	}
+}
+
+func TestUpContextCancelled(t *testing.T) {
+	m := newTestMigrator(t, createTableMigration("20240101000000", "users"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := m.UpContext(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected %s, got %v", context.Canceled, err)
+	}
+
+	if got := appliedVersions(t, m.db); len(got) != 0 {
+		t.Errorf("Expected no applied versions, got %v", got)
+	}
+}
+
+func TestUpWaitsForLock(t *testing.T) {
+	m := newTestMigrator(t, createTableMigration("20240101000000", "users"))
+	m.lockTimeout = time.Second
+
+	// Simulate another process holding the lock
+	other, err := newLocker(m.db, DriverSQLite, "schema_migrations")
+	if err != nil {
+		t.Fatalf("Unable to create locker: %s", err)
+	}
+	if err := other.lock(context.Background(), time.Second); err != nil {
+		t.Fatalf("Unable to acquire lock: %s", err)
+	}
+
+	if err := m.Up(0); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("Expected %s, got %v", ErrLockTimeout, err)
+	}
+
+	if err := m.ForceUnlock(); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if got := appliedVersions(t, m.db); len(got) != 1 {
+		t.Errorf("Expected 1 applied version, got %v", got)
+	}
+}
+
+// failingMigration returns a migration whose Up always fails
+func failingMigration(version string) *Migration {
+	return &Migration{
+		Version: version,
+		Up: func(tx *sql.Tx) error {
+			return errors.New("boom")
+		},
+	}
+}
+
+func TestUpSingleTransactionRollsBackEverything(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		failingMigration("20240102000000"),
+	)
+
+	err := m.Up(0)
+
+	var migrationErr *MigrationError
+	if !errors.As(err, &migrationErr) {
+		t.Fatalf("Expected a MigrationError, got %v", err)
+	}
+
+	if migrationErr.Version != "20240102000000" || migrationErr.Committed != 0 {
+		t.Errorf("Expected failure on 20240102000000 with 0 committed, got %s with %d", migrationErr.Version, migrationErr.Committed)
+	}
+
+	if got := appliedVersions(t, m.db); len(got) != 0 {
+		t.Errorf("Expected no applied versions, got %v", got)
+	}
+}
+
+func TestUpPerMigrationTransactionKeepsCommitted(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		createTableMigration("20240102000000", "posts"),
+		failingMigration("20240103000000"),
+	)
+	WithTxMode(TxPerMigration)(m)
+
+	err := m.Up(0)
+
+	var migrationErr *MigrationError
+	if !errors.As(err, &migrationErr) {
+		t.Fatalf("Expected a MigrationError, got %v", err)
+	}
+
+	if migrationErr.Version != "20240103000000" || migrationErr.Committed != 2 {
+		t.Errorf("Expected failure on 20240103000000 with 2 committed, got %s with %d", migrationErr.Version, migrationErr.Committed)
+	}
+
+	if got := appliedVersions(t, m.db); len(got) != 2 {
+		t.Errorf("Expected 2 applied versions, got %v", got)
+	}
+}
+
+func TestNoTxMigrationRunsOutsideTransaction(t *testing.T) {
+	var calledWith *sql.DB
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		&Migration{
+			Version: "20240102000000",
+			NoTx:    true,
+			UpDB: func(db *sql.DB) error {
+				calledWith = db
+				_, err := db.Exec("CREATE INDEX users_id_index ON users (id)")
+				return err
+			},
+		},
+		failingMigration("20240103000000"),
+	)
+
+	err := m.Up(0)
+
+	var migrationErr *MigrationError
+	if !errors.As(err, &migrationErr) {
+		t.Fatalf("Expected a MigrationError, got %v", err)
+	}
+
+	if calledWith != m.db {
+		t.Errorf("Expected UpDB to receive the migrator's database")
+	}
+
+	// The NoTx migration forces the preceding migration to be committed
+	if migrationErr.Committed != 2 {
+		t.Errorf("Expected 2 committed versions, got %d", migrationErr.Committed)
+	}
+
+	if got := appliedVersions(t, m.db); len(got) != 2 {
+		t.Errorf("Expected 2 applied versions, got %v", got)
+	}
+}
+
+// upInBatches applies each migration of m in a batch of its own
+func upInBatches(t *testing.T, m *Migrator) {
+	t.Helper()
+
+	for range m.Versions {
+		if err := m.Up(1); err != nil {
+			t.Fatalf("Expected error to be nil, got %s", err)
+		}
+	}
+}
+
+func TestDownBatches(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		createTableMigration("20240102000000", "posts"),
+		createTableMigration("20240103000000", "tags"),
+		createTableMigration("20240104000000", "likes"),
+	)
+
+	if err := m.Up(2); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	upInBatches(t, m)
+
+	// Batches: 1 = users and posts, 2 = tags, 3 = likes
+	if err := m.DownBatches(2); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); !reflect.DeepEqual(got, []string{"20240101000000", "20240102000000"}) {
+		t.Errorf("Expected the last 2 batches to be reverted, got %v", got)
+	}
+
+	if err := m.DownBatches(1); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); len(got) != 0 {
+		t.Errorf("Expected the whole first batch to be reverted, got %v", got)
+	}
+}
+
+func TestDownSteps(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		createTableMigration("20240102000000", "posts"),
+		createTableMigration("20240103000000", "tags"),
+	)
+
+	// A single batch, of which only part is reverted
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if err := m.DownSteps(2); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); !reflect.DeepEqual(got, []string{"20240101000000"}) {
+		t.Errorf("Expected the last 2 migrations to be reverted, got %v", got)
+	}
+
+	// Asking for more steps than applied reverts everything
+	if err := m.DownSteps(5); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); len(got) != 0 {
+		t.Errorf("Expected no applied versions, got %v", got)
+	}
+}
+
+func TestDownKeepsCountingBatchesFromZero(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		createTableMigration("20240102000000", "posts"),
+	)
+	upInBatches(t, m)
+
+	if err := m.Down(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); !reflect.DeepEqual(got, []string{"20240101000000"}) {
+		t.Errorf("Expected Down(0) to revert the last batch, got %v", got)
+	}
+}
+
+func TestUpRejectsOutOfOrderMigrations(t *testing.T) {
+	m := newTestMigrator(t, createTableMigration("20240102000000", "posts"))
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	// Merged from another branch after 20240102000000 was applied
+	m.AddMigration(createTableMigration("20240101000000", "users"))
+	m.AddMigration(createTableMigration("20240103000000", "tags"))
+
+	var outOfOrderErr *OutOfOrderError
+	if err := m.Up(0); !errors.As(err, &outOfOrderErr) {
+		t.Fatalf("Expected an OutOfOrderError, got %v", err)
+	}
+	if !reflect.DeepEqual(outOfOrderErr.Versions, []string{"20240101000000"}) || outOfOrderErr.LatestApplied != "20240102000000" {
+		t.Errorf("Unexpected error %s", outOfOrderErr)
+	}
+	if got := appliedVersions(t, m.db); len(got) != 1 {
+		t.Errorf("Expected nothing to be applied, got %v", got)
+	}
+
+	WithAllowOutOfOrder(true)(m)
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); len(got) != 3 {
+		t.Errorf("Expected 3 applied versions, got %v", got)
+	}
+}
+
+func TestUpSkipsMigrationsOfOtherEnvironments(t *testing.T) {
+	fixtures := createTableMigration("20240102000000", "fixtures")
+	fixtures.Environments = []string{"dev", "test"}
+
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		fixtures,
+		createTableMigration("20240103000000", "posts"),
+	)
+	WithEnvironment("prod")(m)
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); !reflect.DeepEqual(got, []string{"20240101000000", "20240103000000"}) {
+		t.Errorf("Expected fixtures to be skipped in prod, got %v", got)
+	}
+
+	states, err := m.MigrationStatus()
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if !states[1].Skipped || states[1].OutOfOrder {
+		t.Errorf("Expected fixtures to be reported as skipped, got %+v", states[1])
+	}
+
+	// The same database used for tests runs it, out of order
+	WithEnvironment("test")(m)
+	WithAllowOutOfOrder(true)(m)
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); len(got) != 3 {
+		t.Errorf("Expected 3 applied versions, got %v", got)
+	}
+}
+
+func TestIsProduction(t *testing.T) {
+	for env, expected := range map[string]bool{"prod": true, "Production": true, "": false, "dev": false, "staging": false} {
+		if got := IsProduction(env); got != expected {
+			t.Errorf("Expected IsProduction(%q) to be %t, got %t", env, expected, got)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package migration
+
+import (
+	"strings"
+	"time"
+)
+
+// Option configures a Migrator
+type Option func(*Migrator)
+
+// WithLockTimeout sets how long Up and Down wait for the migration lock held
+// by another process. A zero timeout waits until the context is done.
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(m *Migrator) {
+		m.lockTimeout = timeout
+	}
+}
+
+// WithTxMode sets how the migrations of a run are wrapped in transactions.
+// Defaults to TxSingle.
+func WithTxMode(mode TxMode) Option {
+	return func(m *Migrator) {
+		m.txMode = mode
+	}
+}
+
+// WithTableName sets the name of the table recording applied migrations.
+// Defaults to DefaultTableName.
+func WithTableName(name string) Option {
+	return func(m *Migrator) {
+		m.tableName = name
+	}
+}
+
+// WithSchema places the migrations table in the given schema, e.g. "meta"
+// for meta.schema_migrations. On Postgres the schema is created if needed.
+func WithSchema(schema string) Option {
+	return func(m *Migrator) {
+		m.schema = schema
+	}
+}
+
+// WithAllowOutOfOrder lets Up apply pending migrations whose version is
+// older than the newest applied one, which are rejected by default
+func WithAllowOutOfOrder(allow bool) Option {
+	return func(m *Migrator) {
+		m.allowOutOfOrder = allow
+	}
+}
+
+// WithLogger sets the logger receiving the progress of the Migrator's runs,
+// e.g. a *slog.Logger. Defaults to the logger set with SetLogger.
+func WithLogger(l Logger) Option {
+	return func(m *Migrator) {
+		m.logger = l
+	}
+}
+
+// WithRegistry adds the migrations and seeders of r to the Migrator's own
+// registry
+func WithRegistry(r *Registry) Option {
+	return func(m *Migrator) {
+		for _, version := range r.Versions {
+			m.AddMigration(r.Migrations[version])
+		}
+		for _, s := range r.Seeders {
+			m.AddSeeder(s)
+		}
+	}
+}
+
+// WithMigrationsDir sets the directory of the migration files, where Squash
+// writes the snapshot and SchemaFile is found. Defaults to MigrationsDir.
+func WithMigrationsDir(dir string) Option {
+	return func(m *Migrator) {
+		m.migrationsDir = strings.TrimSuffix(dir, "/")
+	}
+}
+
+// WithReadOnly makes Init leave the database untouched, for dry runs: the
+// migrations table isn't created or upgraded, and Plan starts with the
+// statements that would do it. A read-only Migrator can only plan, report
+// the status of migrations and release a stale lock with ForceUnlock,
+// without waiting for that lock to upgrade the table first.
+func WithReadOnly(readOnly bool) Option {
+	return func(m *Migrator) {
+		m.readOnly = readOnly
+	}
+}
+
+// WithEnvironment sets the environment the Migrator runs in, such as
+// "dev", "test" or "prod". Defaults to the APP_ENV env variable.
+func WithEnvironment(env string) Option {
+	return func(m *Migrator) {
+		m.environment = env
+	}
+}
@@ -0,0 +1,310 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Plan returns the SQL that Up (for DirectionUp) or Down (for DirectionDown)
+// would run with the given step, without changing the database
+func (m *Migrator) Plan(direction Direction, step int) ([]string, error) {
+	return m.PlanContext(context.Background(), direction, step)
+}
+
+// PlanContext runs the migrations that Up or Down would run against a
+// recording executor and returns every statement they issue, including
+// the transactions and the bookkeeping of the migrations table. Progress is
+// included as "--" comments. Queries issued by migrations return no rows.
+// Hooks are called as well, with a context for which IsDryRun is true.
+func (m *Migrator) PlanContext(ctx context.Context, direction Direction, step int) ([]string, error) {
+	if direction == DirectionDown {
+		return m.PlanDownBatchesContext(ctx, step+1)
+	}
+
+	return m.plan(ctx, DirectionUp, func() ([]*Migration, int, error) {
+		lastBatch, err := m.lastBatch(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		pending, err := m.checkedPending(step)
+		return pending, lastBatch + 1, err
+	})
+}
+
+// PlanDownBatches returns the SQL that DownBatches would run, see PlanContext
+func (m *Migrator) PlanDownBatches(n int) ([]string, error) {
+	return m.PlanDownBatchesContext(context.Background(), n)
+}
+
+// PlanDownBatchesContext is like PlanDownBatches but takes a context
+func (m *Migrator) PlanDownBatchesContext(ctx context.Context, n int) ([]string, error) {
+	return m.plan(ctx, DirectionDown, func() ([]*Migration, int, error) {
+		applied, err := m.lastBatches(ctx, n)
+		return applied, 0, err
+	})
+}
+
+// PlanDownSteps returns the SQL that DownSteps would run, see PlanContext
+func (m *Migrator) PlanDownSteps(n int) ([]string, error) {
+	return m.PlanDownStepsContext(context.Background(), n)
+}
+
+// PlanDownStepsContext is like PlanDownSteps but takes a context
+func (m *Migrator) PlanDownStepsContext(ctx context.Context, n int) ([]string, error) {
+	return m.plan(ctx, DirectionDown, func() ([]*Migration, int, error) {
+		applied, err := m.lastSteps(n)
+		return applied, 0, err
+	})
+}
+
+// plan records the statements of running the migrations returned by
+// selectMigrations, which is called with the applied migrations loaded
+func (m *Migrator) plan(ctx context.Context, direction Direction, selectMigrations func() ([]*Migration, int, error)) ([]string, error) {
+	if err := m.loadApplied(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := m.checkDirty(); err != nil {
+		return nil, err
+	}
+
+	migrations, batch, err := selectMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &recorder{dialect: m.dialect}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+
+	// A read-only Migrator left the migrations table as it was
+	if !m.tableReady(ctx) {
+		if err := m.ensureTable(ctx, db); err != nil {
+			return nil, err
+		}
+	}
+
+	dryRun := *m
+	dryRun.db = db
+	dryRun.recorder = rec
+	if err := dryRun.run(withDryRun(ctx), direction, migrations, batch); err != nil {
+		return nil, err
+	}
+
+	return rec.statements, nil
+}
+
+// WritePlan writes the statements returned by Plan to w, one per line
+func WritePlan(w io.Writer, statements []string) error {
+	for _, statement := range statements {
+		if _, err := fmt.Fprintln(w, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recorder is a database/sql connector whose connections record the
+// statements they receive instead of executing them
+type recorder struct {
+	mu         sync.Mutex
+	dialect    string
+	statements []string
+}
+
+func (r *recorder) Connect(context.Context) (driver.Conn, error) {
+	return &recordingConn{r: r}, nil
+}
+
+func (r *recorder) Driver() driver.Driver {
+	return recordingDriver{r: r}
+}
+
+// record adds a statement with its arguments interpolated
+func (r *recorder) record(query string, args []driver.NamedValue) {
+	statement := strings.TrimSuffix(strings.TrimSpace(interpolate(query, args, r.dialect)), ";") + ";"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = append(r.statements, statement)
+}
+
+// comment adds each line of text as a SQL comment
+func (r *recorder) comment(text string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		r.statements = append(r.statements, "-- "+line)
+	}
+}
+
+type recordingDriver struct {
+	r *recorder
+}
+
+func (d recordingDriver) Open(string) (driver.Conn, error) {
+	return &recordingConn{r: d.r}, nil
+}
+
+type recordingConn struct {
+	r *recorder
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{r: c.r, query: query}, nil
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *recordingConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.r.record("BEGIN", nil)
+	return recordingTx{r: c.r}, nil
+}
+
+func (c *recordingConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.r.record(query, args)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *recordingConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.r.record(query, args)
+	return emptyRows{}, nil
+}
+
+type recordingTx struct {
+	r *recorder
+}
+
+func (tx recordingTx) Commit() error {
+	tx.r.record("COMMIT", nil)
+	return nil
+}
+
+func (tx recordingTx) Rollback() error {
+	tx.r.record("ROLLBACK", nil)
+	return nil
+}
+
+type recordingStmt struct {
+	r     *recorder
+	query string
+}
+
+func (s *recordingStmt) Close() error {
+	return nil
+}
+
+func (s *recordingStmt) NumInput() int {
+	return -1
+}
+
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.r.record(s.query, namedValues(args))
+	return driver.RowsAffected(0), nil
+}
+
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.r.record(s.query, namedValues(args))
+	return emptyRows{}, nil
+}
+
+// emptyRows is the result of every query during a dry run
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string {
+	return nil
+}
+
+func (emptyRows) Close() error {
+	return nil
+}
+
+func (emptyRows) Next([]driver.Value) error {
+	return io.EOF
+}
+
+// namedValues converts positional driver values into named ones
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+// interpolate replaces the bind placeholders of query, "$n" on Postgres and
+// "?" elsewhere, with the SQL literals of args. Placeholders inside quoted
+// strings are left alone.
+func interpolate(query string, args []driver.NamedValue, dialect string) string {
+	if len(args) == 0 {
+		return query
+	}
+
+	var b strings.Builder
+	next := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+2])
+			i += end + 1
+		case c == '?' && dialect != DriverPostgres && next < len(args):
+			b.WriteString(sqlLiteral(args[next].Value))
+			next++
+		case c == '$' && dialect == DriverPostgres:
+			end := i + 1
+			for end < len(query) && query[end] >= '0' && query[end] <= '9' {
+				end++
+			}
+			n, err := strconv.Atoi(query[i+1 : end])
+			if err != nil || n < 1 || n > len(args) {
+				b.WriteByte(c)
+				continue
+			}
+			b.WriteString(sqlLiteral(args[n-1].Value))
+			i = end - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// sqlLiteral formats a driver value as a SQL literal
+func sqlLiteral(value driver.Value) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case []byte:
+		return "'" + strings.ReplaceAll(string(v), "'", "''") + "'"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case time.Time:
+		return "'" + v.UTC().Format("2006-01-02 15:04:05.999999") + "'"
+	default:
+		return fmt.Sprint(v)
+	}
+}
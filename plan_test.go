@@ -0,0 +1,160 @@
+package migration
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPlanDoesNotChangeDatabase(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		createTableMigration("20240102000000", "posts"),
+	)
+
+	if err := m.Up(1); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	statements, err := m.Plan(DirectionUp, 0)
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	plan := strings.Join(statements, "\n")
+	for _, expected := range []string{
+		"BEGIN;",
+		"CREATE TABLE posts (id INTEGER);",
+		"INSERT INTO schema_migrations (version, batch, checksum, applied_at, execution_ms, applied_by) VALUES ('20240102000000', 2, '', '",
+		"COMMIT;",
+	} {
+		if !strings.Contains(plan, expected) {
+			t.Errorf("Expected the plan to contain %q, got:\n%s", expected, plan)
+		}
+	}
+	if strings.Contains(plan, "CREATE TABLE users") {
+		t.Errorf("Expected the applied migration not to be planned, got:\n%s", plan)
+	}
+
+	if got := appliedVersions(t, m.db); len(got) != 1 {
+		t.Errorf("Expected 1 applied version, got %v", got)
+	}
+	if err := m.db.QueryRow("SELECT COUNT(*) FROM posts").Scan(new(int)); err == nil {
+		t.Error("Expected the posts table not to be created")
+	}
+}
+
+func TestPlanRejectsOutOfOrderMigrations(t *testing.T) {
+	m := newTestMigrator(t, createTableMigration("20240102000000", "posts"))
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	m.AddMigration(createTableMigration("20240101000000", "users"))
+
+	// The plan fails like Up would
+	var outOfOrderErr *OutOfOrderError
+	if _, err := m.Plan(DirectionUp, 0); !errors.As(err, &outOfOrderErr) {
+		t.Fatalf("Expected an OutOfOrderError, got %v", err)
+	}
+
+	WithAllowOutOfOrder(true)(m)
+	statements, err := m.Plan(DirectionUp, 0)
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if plan := strings.Join(statements, "\n"); !strings.Contains(plan, "CREATE TABLE users") {
+		t.Errorf("Expected the out of order migration to be planned, got:\n%s", plan)
+	}
+}
+
+func TestPlanDown(t *testing.T) {
+	m := newTestMigrator(t, createTableMigration("20240101000000", "users"))
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	statements, err := m.Plan(DirectionDown, 0)
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	plan := strings.Join(statements, "\n")
+	if !strings.Contains(plan, "DROP TABLE users;") || !strings.Contains(plan, "DELETE FROM schema_migrations WHERE version = '20240101000000';") {
+		t.Errorf("Expected the plan to revert 20240101000000, got:\n%s", plan)
+	}
+
+	if got := appliedVersions(t, m.db); len(got) != 1 {
+		t.Errorf("Expected 1 applied version, got %v", got)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	args := []driver.NamedValue{{Value: "it's"}, {Value: int64(2)}, {Value: nil}}
+
+	if got := interpolate("SELECT '?', ?, ?, ?", args, DriverMySQL); got != "SELECT '?', 'it''s', 2, NULL" {
+		t.Errorf("Unexpected interpolation %q", got)
+	}
+
+	if got := interpolate("SELECT $2, '$1', $1, $3", args, DriverPostgres); got != "SELECT 2, '$1', 'it''s', NULL" {
+		t.Errorf("Unexpected interpolation %q", got)
+	}
+}
+
+func TestReadOnlyPlanSetsUpTableInPlan(t *testing.T) {
+	r := NewRegistry()
+	r.AddMigration(createTableMigration("20240101000000", "users"))
+
+	// A database never migrated
+	db := newTestDB(t)
+	m, err := New(db, DriverSQLite, WithRegistry(r), WithLogger(NopLogger()), WithReadOnly(true))
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	statements, err := m.Plan(DirectionUp, 0)
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if !strings.HasPrefix(statements[0], "CREATE TABLE IF NOT EXISTS schema_migrations") || !strings.Contains(strings.Join(statements, "\n"), "CREATE TABLE users") {
+		t.Errorf("Expected the plan to create the migrations table, got %q", statements)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master").Scan(&count); err != nil || count != 0 {
+		t.Errorf("Expected the database to be left empty, got %d objects, %v", count, err)
+	}
+
+	if err := m.Up(0); err == nil {
+		t.Errorf("Expected a read-only migrator to refuse to migrate")
+	}
+
+	// A table created by an older version
+	db = newTestDB(t)
+	if _, err := db.Exec("CREATE TABLE schema_migrations (version varchar(255), batch int); INSERT INTO schema_migrations VALUES ('20240101000000', 1);"); err != nil {
+		t.Fatalf("Unable to create legacy table: %s", err)
+	}
+	m, err = New(db, DriverSQLite, WithRegistry(r), WithLogger(NopLogger()), WithReadOnly(true))
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	statements, err = m.PlanDownSteps(1)
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	plan := strings.Join(statements, "\n")
+	if !strings.Contains(plan, "ALTER TABLE schema_migrations ADD COLUMN dirty") || !strings.Contains(plan, "CREATE UNIQUE INDEX") || !strings.Contains(plan, "DROP TABLE users") {
+		t.Errorf("Expected the plan to upgrade the migrations table, got %q", statements)
+	}
+
+	rows, err := db.Query("SELECT * FROM schema_migrations")
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	defer rows.Close()
+	if columns, _ := rows.Columns(); len(columns) != 2 {
+		t.Errorf("Expected the legacy table to be left as is, got columns %v", columns)
+	}
+}
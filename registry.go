@@ -0,0 +1,44 @@
+package migration
+
+// Registry collects migrations and seeders, typically from the init
+// functions of a migrations package, so they can be handed to any number of
+// Migrators
+type Registry struct {
+	Versions   []string
+	Migrations map[string]*Migration
+	Seeders    map[string]*Seeder
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		Versions:   []string{},
+		Migrations: map[string]*Migration{},
+		Seeders:    map[string]*Seeder{},
+	}
+}
+
+// AddMigration adds a migration to the registry, replacing any migration
+// registered with the same version
+func (r *Registry) AddMigration(mg *Migration) {
+	_, exists := r.Migrations[mg.Version]
+
+	// Add the migration to the hash with version as key
+	r.Migrations[mg.Version] = mg
+	if exists {
+		return
+	}
+
+	// Insert version into versions array using insertion sort
+	index := 0
+	for index < len(r.Versions) {
+		if r.Versions[index] > mg.Version {
+			break
+		}
+		index++
+	}
+
+	r.Versions = append(r.Versions, mg.Version)
+	copy(r.Versions[index+1:], r.Versions[index:])
+	r.Versions[index] = mg.Version
+}
@@ -0,0 +1,51 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegistryAddMigrationKeepsVersionsSorted(t *testing.T) {
+	r := NewRegistry()
+	r.AddMigration(createTableMigration("20240102000000", "posts"))
+	r.AddMigration(createTableMigration("20240101000000", "users"))
+	r.AddMigration(createTableMigration("20240102000000", "posts"))
+
+	expected := []string{"20240101000000", "20240102000000"}
+	if !reflect.DeepEqual(r.Versions, expected) {
+		t.Errorf("Expected versions %v, got %v", expected, r.Versions)
+	}
+}
+
+func TestMigratorsAreIndependent(t *testing.T) {
+	first := newTestMigrator(t, createTableMigration("20240101000000", "users"))
+	second := newTestMigrator(t, createTableMigration("20240102000000", "posts"))
+
+	if err := first.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if err := second.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if got := appliedVersions(t, first.db); !reflect.DeepEqual(got, []string{"20240101000000"}) {
+		t.Errorf("Expected the first database to only have 20240101000000, got %v", got)
+	}
+	if got := appliedVersions(t, second.db); !reflect.DeepEqual(got, []string{"20240102000000"}) {
+		t.Errorf("Expected the second database to only have 20240102000000, got %v", got)
+	}
+	if len(GetMigrator().Versions) != 0 {
+		t.Errorf("Expected the default migrator to be left untouched, got %v", GetMigrator().Versions)
+	}
+}
+
+func TestInitUsesDefaultMigrator(t *testing.T) {
+	m, err := Init(newTestDB(t), DriverSQLite)
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if m != GetMigrator() {
+		t.Error("Expected Init to return the default migrator")
+	}
+}
@@ -0,0 +1,144 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+)
+
+// Force marks the migration with the given version as applied without
+// running it, see ForceContext
+func (m *Migrator) Force(version string) error {
+	return m.ForceContext(context.Background(), version)
+}
+
+// ForceContext records the migration with the given version as applied in
+// a new batch without running it, e.g. after applying it by hand following
+// a partial failure. Forcing an applied migration does nothing.
+func (m *Migrator) ForceContext(ctx context.Context, version string) error {
+	mg := m.Migrations[version]
+	if mg == nil {
+		return fmt.Errorf("migration %s is not registered", version)
+	}
+
+	return m.withLock(ctx, func() error {
+		if record := m.history[version]; record != nil {
+			if record.dirty == "" {
+				m.log().Info("Migration is already applied", "version", version)
+				return nil
+			}
+
+			if err := m.setDirty(ctx, m.db, version, ""); err != nil {
+				return err
+			}
+			m.log().Info("Marked dirty migration as applied", "version", version)
+			return nil
+		}
+
+		lastBatch, err := m.lastBatch(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := m.recordUp(ctx, m.db, mg, lastBatch+1, 0); err != nil {
+			return err
+		}
+		m.log().Info("Marked migration as applied", "version", version)
+		return nil
+	})
+}
+
+// Unapply removes the record of the migration with the given version
+// without running its down migration, see UnapplyContext
+func (m *Migrator) Unapply(version string) error {
+	return m.UnapplyContext(context.Background(), version)
+}
+
+// UnapplyContext removes the record of the migration with the given
+// version without running its down migration, so that it runs again on
+// the next Up. The migration doesn't need to be registered.
+func (m *Migrator) UnapplyContext(ctx context.Context, version string) error {
+	return m.withLock(ctx, func() error {
+		if !m.applied(version) {
+			return fmt.Errorf("migration %s is not applied", version)
+		}
+
+		if err := m.recordDown(ctx, m.db, &Migration{Version: version}); err != nil {
+			return err
+		}
+		m.log().Info("Removed the record of migration", "version", version)
+		return nil
+	})
+}
+
+// Repair fixes the migrations table to match the registered migrations,
+// see RepairContext
+func (m *Migrator) Repair() error {
+	return m.RepairContext(context.Background())
+}
+
+// RepairContext deletes the records of applied migrations that are no
+// longer registered, and stores the current checksum of the others, so
+// that Validate passes again. The records of migrations replaced by a
+// registered snapshot are kept, see Squash. The records of dirty migrations are restored
+// to their state before the interrupted run: a migration interrupted while
+// being applied is recorded as not applied, and one interrupted while being
+// reverted as applied. Nothing is run: the statements an interrupted
+// migration committed, e.g. DDL on MySQL, must be reverted by hand first.
+func (m *Migrator) RepairContext(ctx context.Context) error {
+	return m.withLock(ctx, func() error {
+		versions := make([]string, 0, len(m.history))
+		for version := range m.history {
+			versions = append(versions, version)
+		}
+		slices.Sort(versions)
+		squashed := m.squashedVersions()
+
+		tx, err := m.db.BeginTx(ctx, &sql.TxOptions{})
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for _, version := range versions {
+			switch m.history[version].dirty {
+			case DirectionUp:
+				if err := m.recordDown(ctx, tx, &Migration{Version: version}); err != nil {
+					return err
+				}
+				m.log().Info("Removed the record of interrupted migration", "version", version)
+				continue
+			case DirectionDown:
+				if err := m.setDirty(ctx, tx, version, ""); err != nil {
+					return err
+				}
+				m.log().Info("Marked interrupted migration as applied", "version", version)
+			}
+
+			if _, ok := squashed[version]; ok {
+				continue
+			}
+
+			mg := m.Migrations[version]
+			if mg == nil {
+				if err := m.recordDown(ctx, tx, &Migration{Version: version}); err != nil {
+					return err
+				}
+				m.log().Info("Removed the record of missing migration", "version", version)
+				continue
+			}
+
+			if mg.matchesChecksum(m.history[version].checksum) {
+				continue
+			}
+
+			if _, err := tx.ExecContext(ctx, "UPDATE "+m.table()+" SET checksum = "+m.bindVar(1)+" WHERE version = "+m.bindVar(2)+";", mg.Checksum, version); err != nil {
+				return err
+			}
+			m.log().Info("Updated the checksum of migration", "version", version)
+		}
+
+		return tx.Commit()
+	})
+}
@@ -0,0 +1,73 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestForceAndUnapply(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		createTableMigration("20240102000000", "posts"),
+	)
+
+	if err := m.Force("20240102000000"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); !reflect.DeepEqual(got, []string{"20240102000000"}) {
+		t.Errorf("Expected 20240102000000 to be marked as applied, got %v", got)
+	}
+	if err := m.db.QueryRow("SELECT COUNT(*) FROM posts").Scan(new(int)); err == nil {
+		t.Error("Expected the migration not to run")
+	}
+
+	// Forcing it again is a no-op
+	if err := m.Force("20240102000000"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if err := m.Force("20240105000000"); err == nil {
+		t.Error("Expected an error for an unregistered version")
+	}
+
+	if err := m.Unapply("20240102000000"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); len(got) != 0 {
+		t.Errorf("Expected no applied versions, got %v", got)
+	}
+	if err := m.Unapply("20240102000000"); err == nil {
+		t.Error("Expected an error for a migration that isn't applied")
+	}
+}
+
+func TestRepair(t *testing.T) {
+	users := createTableMigration("20240101000000", "users")
+	users.Checksum = "original"
+	m := newTestMigrator(t, users, createTableMigration("20240102000000", "posts"))
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	// One migration was edited, another deleted
+	m.Migrations["20240101000000"].Checksum = "edited"
+	delete(m.Migrations, "20240102000000")
+	m.Versions = m.Versions[:1]
+
+	var validationErr *ValidationError
+	if err := m.Validate(); !errors.As(err, &validationErr) || len(validationErr.Issues) != 2 {
+		t.Fatalf("Expected 2 validation issues, got %v", err)
+	}
+
+	if err := m.Repair(); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if err := m.Validate(); err != nil {
+		t.Errorf("Expected the repaired table to be valid, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); !reflect.DeepEqual(got, []string{"20240101000000"}) {
+		t.Errorf("Expected the missing migration to be removed, got %v", got)
+	}
+}
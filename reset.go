@@ -0,0 +1,256 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Reset rolls back every applied migration
+func (m *Migrator) Reset() error {
+	return m.ResetContext(context.Background())
+}
+
+// ResetContext rolls back every applied migration, newest first
+func (m *Migrator) ResetContext(ctx context.Context) error {
+	return m.withLock(ctx, func() error {
+		return m.reset(ctx)
+	})
+}
+
+// Refresh rolls back every applied migration and runs them all again
+func (m *Migrator) Refresh() error {
+	return m.RefreshContext(context.Background())
+}
+
+// RefreshContext rolls back every applied migration and runs them all
+// again, holding the lock in between
+func (m *Migrator) RefreshContext(ctx context.Context) error {
+	return m.withLock(ctx, func() error {
+		if err := m.reset(ctx); err != nil {
+			return err
+		}
+
+		if err := m.loadApplied(ctx); err != nil {
+			return err
+		}
+
+		return m.up(ctx, 0)
+	})
+}
+
+// Fresh drops every table of the database, including the migrations table,
+// and runs all the migrations from scratch. Down migrations are not run.
+func (m *Migrator) Fresh() error {
+	return m.FreshContext(context.Background())
+}
+
+// FreshContext is like Fresh but takes a context
+func (m *Migrator) FreshContext(ctx context.Context) error {
+	return m.withLock(ctx, func() error {
+		if err := m.dropAllTables(ctx); err != nil {
+			return err
+		}
+
+		if err := m.ensureTable(ctx, m.db); err != nil {
+			return err
+		}
+
+		if err := m.loadApplied(ctx); err != nil {
+			return err
+		}
+
+		return m.up(ctx, 0)
+	})
+}
+
+// reset reverts the applied migrations, the lock being held
+func (m *Migrator) reset(ctx context.Context) error {
+	if err := m.checkDirty(); err != nil {
+		return err
+	}
+
+	applied, err := m.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	return m.run(ctx, DirectionDown, applied, 0)
+}
+
+// appliedMigrations returns the applied migrations, newest first
+func (m *Migrator) appliedMigrations() ([]*Migration, error) {
+	return m.lastSteps(len(m.history))
+}
+
+// dbObject is a table or view found in the database
+type dbObject struct {
+	name string
+	view bool
+}
+
+// dropAllTables drops the tables and views of the database, along with the
+// migrations table. On Postgres the other objects of the current schema,
+// such as types and functions, are dropped too. Foreign keys are ignored while dropping, so the order
+// doesn't matter.
+func (m *Migrator) dropAllTables(ctx context.Context) error {
+	// Session settings such as foreign key checks need a single connection
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	objects, err := m.listTables(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	switch m.dialect {
+	case DriverMySQL:
+		if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0;"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.WithoutCancel(ctx), "SET FOREIGN_KEY_CHECKS = 1;")
+	case DriverSQLite:
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF;"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.WithoutCancel(ctx), "PRAGMA foreign_keys = ON;")
+	}
+
+	// Postgres drops the dependent constraints and views along with a table
+	cascade := ""
+	if m.dialect == DriverPostgres {
+		cascade = " CASCADE"
+	}
+
+	for _, object := range objects {
+		kind := "TABLE"
+		if object.view {
+			kind = "VIEW"
+		}
+
+		m.progress("Dropping "+strings.ToLower(kind), "name", object.name)
+		if _, err := conn.ExecContext(ctx, "DROP "+kind+" IF EXISTS "+m.quoteIdent(object.name)+cascade+";"); err != nil {
+			return fmt.Errorf("unable to drop %s %s: %w", strings.ToLower(kind), object.name, err)
+		}
+	}
+
+	// Types, functions and sequences would make the migrations fail with
+	// "already exists" when run again
+	if m.dialect == DriverPostgres {
+		if err := m.dropPostgresObjects(ctx, conn); err != nil {
+			return err
+		}
+	}
+
+	// The migrations table may live in another schema
+	if _, err := conn.ExecContext(ctx, "DROP TABLE IF EXISTS "+m.table()+";"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// postgresObjectsQuery lists the objects of the current schema that are
+// neither tables nor views, along with the kind to drop them with. Objects
+// belonging to an extension are left to it, and functions belonging to a
+// type, such as the constructors of a range type, are dropped with it.
+const postgresObjectsQuery = `SELECT kind, name FROM (
+		SELECT 1 AS position, 'MATERIALIZED VIEW' AS kind, quote_ident(matviewname) AS name, NULL::oid AS oid FROM pg_matviews WHERE schemaname = current_schema()
+		UNION ALL
+		SELECT 2, CASE p.prokind WHEN 'p' THEN 'PROCEDURE' WHEN 'a' THEN 'AGGREGATE' ELSE 'FUNCTION' END, p.oid::regprocedure::text, p.oid
+			FROM pg_proc p WHERE p.pronamespace = quote_ident(current_schema())::regnamespace
+			AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.classid = 'pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'i')
+		UNION ALL
+		SELECT 3, 'SEQUENCE', quote_ident(c.relname), c.oid FROM pg_class c WHERE c.relkind = 'S' AND c.relnamespace = quote_ident(current_schema())::regnamespace
+		UNION ALL
+		SELECT 4, CASE t.typtype WHEN 'd' THEN 'DOMAIN' ELSE 'TYPE' END, format_type(t.oid, NULL), t.oid
+			FROM pg_type t LEFT JOIN pg_class c ON c.oid = t.typrelid
+			WHERE t.typnamespace = quote_ident(current_schema())::regnamespace AND t.typtype IN ('e', 'd', 'r', 'c') AND (t.typtype <> 'c' OR c.relkind = 'c')
+	) objects
+	WHERE oid IS NULL OR NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = objects.oid AND d.deptype = 'e')
+	ORDER BY position, name;`
+
+// dropPostgresObjects drops the materialized views, functions, sequences
+// and user-defined types of the current schema
+func (m *Migrator) dropPostgresObjects(ctx context.Context, conn *sql.Conn) error {
+	rows, err := conn.QueryContext(ctx, postgresObjectsQuery)
+	if err != nil {
+		return err
+	}
+
+	type object struct{ kind, name string }
+	objects := []object{}
+	for rows.Next() {
+		var o object
+		if err := rows.Scan(&o.kind, &o.name); err != nil {
+			rows.Close()
+			return err
+		}
+		objects = append(objects, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, o := range objects {
+		m.progress("Dropping "+strings.ToLower(o.kind), "name", o.name)
+		if _, err := conn.ExecContext(ctx, "DROP "+o.kind+" IF EXISTS "+o.name+" CASCADE;"); err != nil {
+			return fmt.Errorf("unable to drop %s %s: %w", strings.ToLower(o.kind), o.name, err)
+		}
+	}
+	return nil
+}
+
+// listTables returns the tables and views of the current database or
+// schema, views first since they may depend on the tables. The lock table
+// used on SQLite is left out as the lock is held.
+func (m *Migrator) listTables(ctx context.Context, conn *sql.Conn) ([]dbObject, error) {
+	var query string
+	switch m.dialect {
+	case DriverSQLite:
+		query = "SELECT name, type = 'view' FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' ORDER BY type = 'table', name;"
+	case DriverPostgres:
+		query = `SELECT table_name, table_type = 'VIEW' FROM information_schema.tables
+			WHERE table_schema = current_schema() AND table_type IN ('BASE TABLE', 'VIEW') ORDER BY table_type = 'BASE TABLE', table_name;`
+	case DriverMySQL:
+		query = `SELECT table_name, table_type = 'VIEW' FROM information_schema.tables
+			WHERE table_schema = DATABASE() AND table_type IN ('BASE TABLE', 'VIEW') ORDER BY table_type = 'BASE TABLE', table_name;`
+	}
+
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lockTable := ""
+	if m.dialect == DriverSQLite && m.schema == "" {
+		lockTable = m.tableName + "_lock"
+	}
+
+	objects := []dbObject{}
+	for rows.Next() {
+		var object dbObject
+		if err := rows.Scan(&object.name, &object.view); err != nil {
+			return nil, err
+		}
+		if object.name == lockTable {
+			continue
+		}
+		objects = append(objects, object)
+	}
+	return objects, rows.Err()
+}
+
+// quoteIdent quotes an identifier for the dialect
+func (m *Migrator) quoteIdent(name string) string {
+	if m.dialect == DriverMySQL {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,110 @@
+package migration
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestReset(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		createTableMigration("20240102000000", "posts"),
+	)
+
+	if err := m.Up(1); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if err := m.Reset(); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if got := appliedVersions(t, m.db); len(got) != 0 {
+		t.Errorf("Expected no applied versions, got %v", got)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240101000000", "users"),
+		createTableMigration("20240102000000", "posts"),
+	)
+
+	if err := m.Up(1); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if _, err := m.db.Exec("INSERT INTO users VALUES (1)"); err != nil {
+		t.Fatalf("Unable to insert user: %s", err)
+	}
+
+	if err := m.Refresh(); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	expected := []string{"20240101000000", "20240102000000"}
+	if got := appliedVersions(t, m.db); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected applied versions %v, got %v", expected, got)
+	}
+
+	var count int
+	if err := m.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil || count != 0 {
+		t.Errorf("Expected users to be recreated empty, got %d rows (%v)", count, err)
+	}
+}
+
+func TestFreshDropsAllTables(t *testing.T) {
+	m := newTestMigrator(t, &Migration{
+		Version: "20240101000000",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY)")
+			return err
+		},
+		// Fresh must not rely on down migrations
+		Down: failingMigration("").Up,
+	})
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	// Tables unknown to the migrations, referencing each other
+	if _, err := m.db.Exec(`PRAGMA foreign_keys = ON;
+		CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users (id));
+		CREATE TABLE comments (post_id INTEGER REFERENCES posts (id));
+		CREATE VIEW user_posts AS SELECT * FROM users JOIN posts ON posts.user_id = users.id;
+		INSERT INTO users VALUES (1); INSERT INTO posts VALUES (1, 1); INSERT INTO comments VALUES (1);`); err != nil {
+		t.Fatalf("Unable to create tables: %s", err)
+	}
+
+	if err := m.Fresh(); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	rows, err := m.db.Query("SELECT name FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		t.Fatalf("Unable to list tables: %s", err)
+	}
+	defer rows.Close()
+
+	tables := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("Unable to scan table: %s", err)
+		}
+		tables = append(tables, name)
+	}
+
+	expected := []string{"schema_migrations", "schema_migrations_lock", "users"}
+	if !reflect.DeepEqual(tables, expected) {
+		t.Errorf("Expected tables %v, got %v", expected, tables)
+	}
+
+	if got := appliedVersions(t, m.db); !reflect.DeepEqual(got, []string{"20240101000000"}) {
+		t.Errorf("Expected 20240101000000 to be applied, got %v", got)
+	}
+}
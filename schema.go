@@ -0,0 +1,322 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// schemaObject is an object of the database schema with the statement
+// creating it
+type schemaObject struct {
+	// kind is "table", "view", "index", "trigger", "sequence" or
+	// "constraint"
+	kind   string
+	name   string
+	create string
+}
+
+// introspectSchema returns the objects of the current database or schema,
+// in an order they can be created in, leaving out the migrations table
+func (m *Migrator) introspectSchema(ctx context.Context) ([]schemaObject, error) {
+	// Some dialects need several queries on the same session
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	switch m.dialect {
+	case DriverSQLite:
+		return m.introspectSQLite(ctx, conn)
+	case DriverMySQL:
+		return m.introspectMySQL(ctx, conn)
+	case DriverPostgres:
+		return m.introspectPostgres(ctx, conn)
+	}
+	return nil, ErrUnsupportedDialect
+}
+
+// ownsTable reports whether name is one of the tables of the migrator in
+// the current database or schema
+func (m *Migrator) ownsTable(name string) bool {
+	return m.schema == "" && (name == m.tableName || name == m.tableName+"_lock")
+}
+
+// introspectSQLite reads the statements stored in sqlite_master
+func (m *Migrator) introspectSQLite(ctx context.Context, conn *sql.Conn) ([]schemaObject, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT type, name, tbl_name, sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+		ORDER BY CASE type WHEN 'table' THEN 0 WHEN 'index' THEN 1 WHEN 'view' THEN 2 ELSE 3 END, rowid;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := []schemaObject{}
+	for rows.Next() {
+		var object schemaObject
+		var table string
+		if err := rows.Scan(&object.kind, &object.name, &table, &object.create); err != nil {
+			return nil, err
+		}
+		if m.ownsTable(table) {
+			continue
+		}
+		objects = append(objects, object)
+	}
+	return objects, rows.Err()
+}
+
+var (
+	// mysqlAutoIncrementPattern matches the AUTO_INCREMENT counter of SHOW CREATE TABLE
+	mysqlAutoIncrementPattern = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+	// mysqlDefinerPattern matches the DEFINER clause of SHOW CREATE VIEW
+	mysqlDefinerPattern = regexp.MustCompile(` DEFINER=\S+`)
+)
+
+// introspectMySQL reads the statements returned by SHOW CREATE. Foreign
+// key checks are disabled around them, so the tables can reference each
+// other in any order.
+func (m *Migrator) introspectMySQL(ctx context.Context, conn *sql.Conn) ([]schemaObject, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT table_name, table_type = 'VIEW' FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_type IN ('BASE TABLE', 'VIEW') ORDER BY table_type = 'VIEW', table_name;`)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []dbObject{}
+	for rows.Next() {
+		var object dbObject
+		if err := rows.Scan(&object.name, &object.view); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if !m.ownsTable(object.name) {
+			objects = append(objects, object)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	schema := []schemaObject{{kind: "setting", create: "SET FOREIGN_KEY_CHECKS = 0"}}
+	for _, object := range objects {
+		kind := "TABLE"
+		if object.view {
+			kind = "VIEW"
+		}
+
+		// SHOW CREATE VIEW returns more columns than SHOW CREATE TABLE
+		showRows, err := conn.QueryContext(ctx, "SHOW CREATE "+kind+" "+m.quoteIdent(object.name)+";")
+		if err != nil {
+			return nil, err
+		}
+		columns, err := showRows.Columns()
+		if err != nil {
+			showRows.Close()
+			return nil, err
+		}
+		values := make([]sql.RawBytes, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		var create string
+		if showRows.Next() {
+			if err := showRows.Scan(dest...); err != nil {
+				showRows.Close()
+				return nil, err
+			}
+			create = string(values[1])
+		}
+		showRows.Close()
+
+		if object.view {
+			create = mysqlDefinerPattern.ReplaceAllString(create, "")
+			schema = append(schema, schemaObject{kind: "view", name: object.name, create: create})
+		} else {
+			create = mysqlAutoIncrementPattern.ReplaceAllString(create, "")
+			schema = append(schema, schemaObject{kind: "table", name: object.name, create: create})
+		}
+	}
+
+	return append(schema, schemaObject{kind: "setting", create: "SET FOREIGN_KEY_CHECKS = 1"}), nil
+}
+
+// introspectPostgres rebuilds the statements of the current schema from
+// the catalog: sequences, tables with their columns and constraints, then
+// indexes, foreign keys and views
+func (m *Migrator) introspectPostgres(ctx context.Context, conn *sql.Conn) ([]schemaObject, error) {
+	objects := []schemaObject{}
+
+	sequences, err := queryStrings(ctx, conn, `SELECT sequence_name FROM information_schema.sequences
+		WHERE sequence_schema = current_schema() ORDER BY sequence_name;`)
+	if err != nil {
+		return nil, err
+	}
+	for _, sequence := range sequences {
+		objects = append(objects, schemaObject{kind: "sequence", name: sequence, create: "CREATE SEQUENCE IF NOT EXISTS " + m.quoteIdent(sequence)})
+	}
+
+	tables, err := queryStrings(ctx, conn, `SELECT table_name FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name;`)
+	if err != nil {
+		return nil, err
+	}
+
+	foreignKeys := []schemaObject{}
+	for _, table := range tables {
+		if m.ownsTable(table) {
+			continue
+		}
+
+		definitions, err := queryStrings(ctx, conn, `SELECT quote_ident(a.attname) || ' ' || format_type(a.atttypid, a.atttypmod)
+				|| CASE a.attidentity WHEN 'a' THEN ' GENERATED ALWAYS AS IDENTITY' WHEN 'd' THEN ' GENERATED BY DEFAULT AS IDENTITY' ELSE '' END
+				|| COALESCE(' DEFAULT ' || pg_get_expr(d.adbin, d.adrelid), '')
+				|| CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END
+			FROM pg_attribute a LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+			WHERE a.attrelid = (quote_ident(current_schema()) || '.' || quote_ident($1))::regclass AND a.attnum > 0 AND NOT a.attisdropped
+			ORDER BY a.attnum;`, table)
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := conn.QueryContext(ctx, `SELECT conname, contype = 'f', pg_get_constraintdef(oid) FROM pg_constraint
+			WHERE conrelid = (quote_ident(current_schema()) || '.' || quote_ident($1))::regclass ORDER BY contype, conname;`, table)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var name, definition string
+			var foreign bool
+			if err := rows.Scan(&name, &foreign, &definition); err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			constraint := "CONSTRAINT " + m.quoteIdent(name) + " " + definition
+			if foreign {
+				// Added once every table exists
+				foreignKeys = append(foreignKeys, schemaObject{kind: "constraint", name: name, create: "ALTER TABLE " + m.quoteIdent(table) + " ADD " + constraint})
+			} else {
+				definitions = append(definitions, constraint)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, schemaObject{
+			kind:   "table",
+			name:   table,
+			create: "CREATE TABLE " + m.quoteIdent(table) + " (\n\t" + strings.Join(definitions, ",\n\t") + "\n)",
+		})
+	}
+
+	// Indexes backing constraints are created along with them
+	rows, err := conn.QueryContext(ctx, `SELECT i.indexname, i.tablename, i.indexdef FROM pg_indexes i
+		WHERE i.schemaname = current_schema()
+		AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = (quote_ident(i.schemaname) || '.' || quote_ident(i.indexname))::regclass)
+		ORDER BY i.tablename, i.indexname;`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var object schemaObject
+		var table string
+		if err := rows.Scan(&object.name, &table, &object.create); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if m.ownsTable(table) {
+			continue
+		}
+		object.kind = "index"
+		objects = append(objects, object)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	objects = append(objects, foreignKeys...)
+
+	rows, err = conn.QueryContext(ctx, `SELECT viewname, pg_get_viewdef((quote_ident(schemaname) || '.' || quote_ident(viewname))::regclass, true) FROM pg_views
+		WHERE schemaname = current_schema() ORDER BY viewname;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, definition string
+		if err := rows.Scan(&name, &definition); err != nil {
+			return nil, err
+		}
+		objects = append(objects, schemaObject{
+			kind:   "view",
+			name:   name,
+			create: "CREATE VIEW " + m.quoteIdent(name) + " AS\n" + strings.TrimSuffix(strings.TrimSpace(definition), ";"),
+		})
+	}
+
+	return objects, rows.Err()
+}
+
+// queryStrings returns the first column of the rows of a query
+func queryStrings(ctx context.Context, conn *sql.Conn, query string, args ...any) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// createStatements returns the statements creating the objects, one per line
+func createStatements(objects []schemaObject) string {
+	var b strings.Builder
+	for _, object := range objects {
+		b.WriteString(strings.TrimSuffix(strings.TrimSpace(object.create), ";"))
+		b.WriteString(";\n")
+	}
+	return b.String()
+}
+
+// dropStatements returns the statements dropping the tables and views of
+// objects, in reverse order
+func (m *Migrator) dropStatements(objects []schemaObject) string {
+	cascade := ""
+	if m.dialect == DriverPostgres {
+		cascade = " CASCADE"
+	}
+
+	var b strings.Builder
+	if m.dialect == DriverMySQL {
+		b.WriteString("SET FOREIGN_KEY_CHECKS = 0;\n")
+	}
+	for i := len(objects) - 1; i >= 0; i-- {
+		object := objects[i]
+		if object.kind != "table" && object.kind != "view" {
+			continue
+		}
+		fmt.Fprintf(&b, "DROP %s IF EXISTS %s%s;\n", strings.ToUpper(object.kind), m.quoteIdent(object.name), cascade)
+	}
+	if m.dialect == DriverMySQL {
+		b.WriteString("SET FOREIGN_KEY_CHECKS = 1;\n")
+	}
+	return b.String()
+}
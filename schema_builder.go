@@ -676,8 +676,8 @@ func (s *Schema) buildCreateSQLite() string {
 			}
 
 			if hasCompositePrimaryKey {
-				fmt.Println(fmt.Sprintf("[Warning: %s column is marked as incremental, however a composite primary key is provided.\n"+
-					"The provided primary columns have been set as a unique key and the incremental column has been set as the primary key.]", column.name))
+				logger().Warn("Column is marked as incremental, however a composite primary key is provided. "+
+					"The provided primary columns have been set as a unique key and the incremental column has been set as the primary key.", "column", column.name)
 			}
 			column.primary = true
 		}
@@ -0,0 +1,201 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+//go:embed template_seeder.txt
+var seederStub string
+
+// Seeder fills tables with data, e.g. fixtures for development or the
+// reference data every environment needs
+type Seeder struct {
+	Name string
+	Run  func(*sql.Tx) error
+
+	// DependsOn lists the seeders that must run before this one. They are
+	// run along with it.
+	DependsOn []string
+
+	// Environments lists the environments the seeder runs in, such as
+	// "dev", "test" or "prod". A seeder without Environments runs in every
+	// environment.
+	Environments []string
+}
+
+// runsIn reports whether the seeder is meant for the environment env
+func (s *Seeder) runsIn(env string) bool {
+	return inEnvironment(s.Environments, env)
+}
+
+// AddSeeder adds a seeder to the registry, replacing any seeder registered
+// with the same name
+func (r *Registry) AddSeeder(s *Seeder) {
+	r.Seeders[s.Name] = s
+}
+
+// Seed runs the given seeders, or every registered seeder when no name is
+// given, see SeedContext
+func (m *Migrator) Seed(names ...string) error {
+	return m.SeedContext(context.Background(), names...)
+}
+
+// SeedContext runs the given seeders, or every registered seeder when no
+// name is given, after the seeders they depend on. Seeders not meant for
+// the Migrator's environment are skipped, along with the seeders depending
+// on them. Each seeder runs in its own transaction, and seeding stops at the first failure.
+func (m *Migrator) SeedContext(ctx context.Context, names ...string) error {
+	if len(names) == 0 {
+		for name := range m.Seeders {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+	}
+
+	seeders, err := m.seedOrder(names)
+	if err != nil {
+		return err
+	}
+
+	env := m.Environment()
+	skipped := map[string]bool{}
+	for _, s := range seeders {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !s.runsIn(env) {
+			m.log().Info("Skipping seeder", "name", s.Name, "env", env)
+			skipped[s.Name] = true
+			continue
+		}
+
+		// The dependencies come first, the data of a skipped one is missing
+		if i := slices.IndexFunc(s.DependsOn, func(name string) bool { return skipped[name] }); i >= 0 {
+			m.log().Info("Skipping seeder", "name", s.Name, "env", env, "dependency", s.DependsOn[i])
+			skipped[s.Name] = true
+			continue
+		}
+
+		m.log().Info("Running seeder", "name", s.Name)
+		tx, err := m.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if s.Run != nil {
+			if err := s.Run(tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("seeder %s failed: %w", s.Name, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("seeder %s failed: %w", s.Name, err)
+		}
+		m.log().Info("Finished running seeder", "name", s.Name)
+	}
+
+	return nil
+}
+
+// seedOrder returns the named seeders and their dependencies, each after
+// the seeders it depends on
+func (m *Migrator) seedOrder(names []string) ([]*Seeder, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	order := []*Seeder{}
+	state := map[string]int{}
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("seeders depend on each other: %s", strings.Join(append(path, name), " -> "))
+		}
+
+		s := m.Seeders[name]
+		if s == nil {
+			return fmt.Errorf("seeder %s is not registered", name)
+		}
+
+		state[name] = visiting
+		for _, dependency := range s.DependsOn {
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+
+		order = append(order, s)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// SeedersDir returns the directory seeder files are generated in, taken
+// from the SEEDERS_DIR env variable. Defaults to migrationsDir, so the
+// seeders are compiled along with the migrations.
+func SeedersDir(migrationsDir string) string {
+	if seedersDir := os.Getenv("SEEDERS_DIR"); seedersDir != "" {
+		return strings.TrimSuffix(seedersDir, "/")
+	}
+	return strings.TrimSuffix(migrationsDir, "/")
+}
+
+// CreateSeeder creates a seeder file registering an empty seeder in the
+// directory dir
+func CreateSeeder(dir string, name string) error {
+	if !regexp.MustCompile(`^\w+$`).MatchString(name) {
+		return errors.New("seeder name may only contain letters, digits and underscores")
+	}
+
+	seedersDir := strings.TrimSuffix(dir, "/")
+	path, err := makeMigrationsDir(seedersDir)
+	if err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%s/%s_seeder.go", path, name)
+	if _, err := os.Stat(fileName); err == nil {
+		return fmt.Errorf("seeder file %s already exists", fileName)
+	}
+
+	in := struct {
+		Name        string
+		PackageName string
+	}{
+		Name:        name,
+		PackageName: guessPackageNameFromMigrationsDir(seedersDir),
+	}
+
+	var out bytes.Buffer
+	if err := template.Must(template.New("seeder").Parse(seederStub)).Execute(&out, in); err != nil {
+		return errors.New("Unable to execute template:" + err.Error())
+	}
+	if err := os.WriteFile(fileName, out.Bytes(), 0o644); err != nil {
+		return errors.New("Unable to create seeder file:" + err.Error())
+	}
+
+	logger().Info("Generated new seeder file", "path", fileName)
+	return nil
+}
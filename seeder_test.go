@@ -0,0 +1,96 @@
+package migration
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recordingSeeder returns a seeder appending its name to ran
+func recordingSeeder(name string, ran *[]string, dependsOn ...string) *Seeder {
+	return &Seeder{
+		Name:      name,
+		DependsOn: dependsOn,
+		Run: func(tx *sql.Tx) error {
+			*ran = append(*ran, name)
+			return nil
+		},
+	}
+}
+
+func TestSeedRunsDependenciesFirst(t *testing.T) {
+	ran := []string{}
+	m := newTestMigrator(t)
+	m.AddSeeder(recordingSeeder("posts", &ran, "users"))
+	m.AddSeeder(recordingSeeder("users", &ran, "roles"))
+	m.AddSeeder(recordingSeeder("roles", &ran))
+	m.AddSeeder(recordingSeeder("tags", &ran))
+
+	if err := m.Seed("posts"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if !reflect.DeepEqual(ran, []string{"roles", "users", "posts"}) {
+		t.Errorf("Expected posts to run after its dependencies, got %v", ran)
+	}
+
+	ran = ran[:0]
+	if err := m.Seed(); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if !reflect.DeepEqual(ran, []string{"roles", "users", "posts", "tags"}) {
+		t.Errorf("Expected every seeder to run once, got %v", ran)
+	}
+}
+
+func TestSeedSkipsOtherEnvironments(t *testing.T) {
+	ran := []string{}
+	m := newTestMigrator(t)
+	WithEnvironment("prod")(m)
+
+	fixtures := recordingSeeder("fixtures", &ran)
+	fixtures.Environments = []string{"dev", "test"}
+	m.AddSeeder(fixtures)
+	m.AddSeeder(recordingSeeder("countries", &ran))
+
+	if err := m.Seed(); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if !reflect.DeepEqual(ran, []string{"countries"}) {
+		t.Errorf("Expected only countries to run in prod, got %v", ran)
+	}
+}
+
+func TestSeedSkipsDependentsOfSkippedSeeders(t *testing.T) {
+	ran := []string{}
+	m := newTestMigrator(t)
+	WithEnvironment("dev")(m)
+
+	users := recordingSeeder("users", &ran)
+	users.Environments = []string{"prod"}
+	m.AddSeeder(users)
+	m.AddSeeder(recordingSeeder("posts", &ran, "users"))
+	m.AddSeeder(recordingSeeder("comments", &ran, "posts"))
+	m.AddSeeder(recordingSeeder("countries", &ran))
+
+	if err := m.Seed("comments", "countries"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if !reflect.DeepEqual(ran, []string{"countries"}) {
+		t.Errorf("Expected the dependents of users to be skipped in dev, got %v", ran)
+	}
+}
+
+func TestSeedRejectsCycles(t *testing.T) {
+	ran := []string{}
+	m := newTestMigrator(t)
+	m.AddSeeder(recordingSeeder("users", &ran, "posts"))
+	m.AddSeeder(recordingSeeder("posts", &ran, "users"))
+
+	if err := m.Seed("users"); err == nil || !strings.Contains(err.Error(), "users -> posts -> users") {
+		t.Fatalf("Expected a dependency cycle, got %v", err)
+	}
+	if len(ran) != 0 {
+		t.Errorf("Expected no seeder to run, got %v", ran)
+	}
+}
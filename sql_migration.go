@@ -0,0 +1,240 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// sqlMigrationPattern matches file names like 20220729200658_create_users_table.up.sql
+var sqlMigrationPattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// noTxDirective on a line of its own marks a SQL migration that must run
+// outside of a transaction, like a Migration with NoTx set
+const noTxDirective = "-- migration:notx"
+
+// sqlMigration holds the contents of a VERSION_name.up.sql/.down.sql pair
+type sqlMigration struct {
+	version string
+	name    string
+	up      string
+	down    string
+	hasUp   bool
+}
+
+// AddSQLMigrationsDir registers the SQL migrations found in dir
+func (r *Registry) AddSQLMigrationsDir(dir string) error {
+	return r.AddSQLMigrations(os.DirFS(dir), ".")
+}
+
+// AddSQLMigrations registers the VERSION_name.up.sql and VERSION_name.down.sql
+// files found in dir of fsys, which can be an embed.FS. They are merged with
+// the Go migrations into the same ordered Versions list.
+func (r *Registry) AddSQLMigrations(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	found := map[string]*sqlMigration{}
+	versions := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := sqlMigrationPattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		version, name, direction := match[1], match[2], match[3]
+		sm := found[version]
+		if sm == nil {
+			sm = &sqlMigration{version: version, name: name}
+			found[version] = sm
+			versions = append(versions, version)
+		} else if sm.name != name {
+			return fmt.Errorf("SQL migration %s has files with different names: %s and %s", version, sm.name, name)
+		}
+
+		if direction == string(DirectionUp) {
+			sm.up = string(content)
+			sm.hasUp = true
+		} else {
+			sm.down = string(content)
+		}
+	}
+
+	for _, version := range versions {
+		sm := found[version]
+		if !sm.hasUp {
+			return fmt.Errorf("SQL migration %s_%s has no .up.sql file", sm.version, sm.name)
+		}
+
+		if r.Migrations[version] != nil {
+			return fmt.Errorf("migration %s is registered more than once", version)
+		}
+
+		r.AddMigration(sm.migration())
+	}
+
+	return nil
+}
+
+// migration converts the SQL files into a Migration
+func (sm *sqlMigration) migration() *Migration {
+	mg := &Migration{Version: sm.version, Name: sm.name, Checksum: checksum(sm.up), Squashes: parseSquashesDirective(sm.up)}
+	mg.Snapshot, mg.SquashedChecksums = parseSquashedDirective(sm.up)
+
+	if hasNoTxDirective(sm.up) {
+		mg.NoTx = true
+		mg.UpDBContext = func(ctx context.Context, db *sql.DB) error {
+			return execStatements(ctx, db, sm.up)
+		}
+		mg.DownDBContext = func(ctx context.Context, db *sql.DB) error {
+			return execStatements(ctx, db, sm.down)
+		}
+		return mg
+	}
+
+	mg.UpContext = func(ctx context.Context, tx *sql.Tx) error {
+		return execStatements(ctx, tx, sm.up)
+	}
+	mg.DownContext = func(ctx context.Context, tx *sql.Tx) error {
+		return execStatements(ctx, tx, sm.down)
+	}
+	return mg
+}
+
+// hasNoTxDirective reports whether the SQL contains the no transaction directive
+func hasNoTxDirective(body string) bool {
+	for _, line := range strings.Split(body, "\n") {
+		if strings.TrimSpace(line) == noTxDirective {
+			return true
+		}
+	}
+	return false
+}
+
+// execer is implemented by *sql.DB, *sql.Tx and *sql.Conn
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// execStatements runs each statement of body in turn. The statements are
+// sent one by one since not every driver accepts several in one call.
+func execStatements(ctx context.Context, db execer, body string) error {
+	for _, statement := range splitStatements(body) {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits SQL on semicolons that end a statement, skipping
+// those inside quotes, comments and Postgres dollar quoted strings. Parts
+// made only of comments and whitespace are dropped.
+func splitStatements(body string) []string {
+	statements := []string{}
+	start := 0
+	hasCode := false
+
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '-' && strings.HasPrefix(body[i:], "--"):
+			if end := strings.IndexByte(body[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(body)
+			}
+		case c == '/' && strings.HasPrefix(body[i:], "/*"):
+			if end := strings.Index(body[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(body)
+			}
+		case c == '\'' || c == '"' || c == '`':
+			hasCode = true
+			// A doubled quote escapes itself and simply reopens the string
+			if end := strings.IndexByte(body[i+1:], c); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(body)
+			}
+		case c == '$':
+			hasCode = true
+			tag := dollarQuoteTag(body[i:])
+			if tag == "" {
+				continue
+			}
+			if end := strings.Index(body[i+len(tag):], tag); end >= 0 {
+				i += len(tag) + end + len(tag) - 1
+			} else {
+				i = len(body)
+			}
+		case c == ';':
+			if hasCode {
+				statements = append(statements, strings.TrimSpace(body[start:i]))
+			}
+			start = i + 1
+			hasCode = false
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+			hasCode = true
+		}
+	}
+
+	if hasCode && start < len(body) {
+		statements = append(statements, strings.TrimSpace(body[start:]))
+	}
+
+	return statements
+}
+
+// dollarQuoteTagPattern matches the opening tag of a dollar quoted string
+var dollarQuoteTagPattern = regexp.MustCompile(`^\$[A-Za-z_]*\$`)
+
+// dollarQuoteTag returns the tag opening a dollar quoted string at the start
+// of s, like $$ or $body$, or an empty string if there is none
+func dollarQuoteTag(s string) string {
+	return dollarQuoteTagPattern.FindString(s)
+}
+
+// CreateSQLMigration creates a pair of empty up and down SQL migration files
+// in the directory dir
+func CreateSQLMigration(dir string, name string) error {
+	if !regexp.MustCompile(`^\w+$`).MatchString(name) {
+		return errors.New("migration name may only contain letters, digits and underscores")
+	}
+
+	path, err := makeMigrationsDir(dir)
+	if err != nil {
+		return err
+	}
+
+	version := time.Now().Format("20060102150405")
+	for _, direction := range []Direction{DirectionUp, DirectionDown} {
+		fileName := fmt.Sprintf("%s/%s_%s.%s.sql", path, version, name, direction)
+		content := fmt.Sprintf("-- Write the %s migration for %s_%s here\n", direction, version, name)
+		if err := os.WriteFile(fileName, []byte(content), 0o644); err != nil {
+			return errors.New("Unable to create migration file:" + err.Error())
+		}
+		logger().Info("Generated new migration file", "path", fileName)
+	}
+
+	return nil
+}
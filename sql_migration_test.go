@@ -0,0 +1,114 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSplitStatements(t *testing.T) {
+	body := `-- create the users table
+CREATE TABLE users (name TEXT DEFAULT 'a;b');
+/* a comment; with a semicolon */
+INSERT INTO users VALUES ('it''s;');
+CREATE FUNCTION f() RETURNS void AS $body$ BEGIN PERFORM 1; END; $body$ LANGUAGE plpgsql;
+-- trailing comment`
+
+	expected := []string{
+		"-- create the users table\nCREATE TABLE users (name TEXT DEFAULT 'a;b')",
+		"/* a comment; with a semicolon */\nINSERT INTO users VALUES ('it''s;')",
+		"CREATE FUNCTION f() RETURNS void AS $body$ BEGIN PERFORM 1; END; $body$ LANGUAGE plpgsql",
+	}
+
+	if got := splitStatements(body); !reflect.DeepEqual(got, expected) {
+		t.Errorf("\nExpected:\n%q\nGot:\n%q", expected, got)
+	}
+}
+
+func TestAddSQLMigrationsMergesWithGoMigrations(t *testing.T) {
+	m := newTestMigrator(t,
+		createTableMigration("20240102000000", "posts"),
+	)
+
+	fsys := fstest.MapFS{
+		"migrations/20240101000000_create_users.up.sql":    {Data: []byte("CREATE TABLE users (id INTEGER);\nCREATE INDEX users_id ON users (id);")},
+		"migrations/20240101000000_create_users.down.sql":  {Data: []byte("DROP TABLE users;")},
+		"migrations/20240103000000_create_tags.up.sql":     {Data: []byte("CREATE TABLE tags (id INTEGER);")},
+		"migrations/20240103000000_create_tags.down.sql":   {Data: []byte("DROP TABLE tags;")},
+		"migrations/README.md":                             {Data: []byte("not a migration")},
+		"migrations/20240104000000_add_index.up.sql":       {Data: []byte(noTxDirective + "\nCREATE INDEX tags_id ON tags (id);")},
+		"migrations/20240104000000_add_index.down.sql":     {Data: []byte(noTxDirective + "\nDROP INDEX tags_id;")},
+		"migrations/nested/20240105000000_ignored.up.sql":  {Data: []byte("CREATE TABLE ignored (id INTEGER);")},
+		"migrations/nested/20240105000000_ignored.down.sq": {Data: []byte("DROP TABLE ignored;")},
+	}
+
+	if err := m.AddSQLMigrations(fsys, "migrations"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	expected := []string{"20240101000000", "20240102000000", "20240103000000", "20240104000000"}
+	if !reflect.DeepEqual(m.Versions, expected) {
+		t.Fatalf("Expected versions %v, got %v", expected, m.Versions)
+	}
+
+	if !m.Migrations["20240104000000"].NoTx {
+		t.Errorf("Expected the %s directive to mark the migration as NoTx", noTxDirective)
+	}
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if got := appliedVersions(t, m.db); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected applied versions %v, got %v", expected, got)
+	}
+}
+
+func TestAddSQLMigrationsRequiresUpFile(t *testing.T) {
+	m := newTestMigrator(t)
+
+	fsys := fstest.MapFS{
+		"20240101000000_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	}
+
+	if err := m.AddSQLMigrations(fsys, "."); err == nil {
+		t.Error("Expected an error for a migration without an .up.sql file")
+	}
+}
+
+func TestAddSQLMigrationsRejectsDuplicateVersion(t *testing.T) {
+	m := newTestMigrator(t, createTableMigration("20240101000000", "users"))
+
+	fsys := fstest.MapFS{
+		"20240101000000_create_users.up.sql": {Data: []byte("CREATE TABLE users (id INTEGER);")},
+	}
+
+	if err := m.AddSQLMigrations(fsys, "."); err == nil {
+		t.Error("Expected an error for a version registered twice")
+	}
+}
+
+func TestNoTxSQLMigrationUsesRunContext(t *testing.T) {
+	m := newTestMigrator(t)
+
+	fsys := fstest.MapFS{
+		"20240101000000_index_users.up.sql": {Data: []byte("-- migration:notx\nCREATE TABLE users (id INTEGER);")},
+	}
+	if err := m.AddSQLMigrations(fsys, "."); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	mg := m.Migrations["20240101000000"]
+	if !mg.NoTx {
+		t.Fatal("Expected the migration to run outside a transaction")
+	}
+
+	// A cancelled run must not start the statements
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := mg.upDB(ctx, m.db); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected %s, got %v", context.Canceled, err)
+	}
+}
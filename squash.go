@@ -0,0 +1,177 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// squashedDirective marks a snapshot written by Squash, followed by the
+	// checksums the databases migrated before the squash recorded
+	squashedDirective = "-- migration:squashed"
+	// squashesDirective lists, on lines of their own, the versions a
+	// snapshot replaces
+	squashesDirective = "-- migration:squashes"
+)
+
+// migrationFilePattern matches the files of Go and SQL migrations
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_\w+(\.go|\.up\.sql|\.down\.sql)$`)
+
+// Squash replaces the migrations up to version with a snapshot, see SquashContext
+func (m *Migrator) Squash(version string) error {
+	return m.SquashContext(context.Background(), version)
+}
+
+// SquashContext replaces the migrations up to and including version with a
+// single SQL migration, VERSION_squashed, holding the schema they create.
+// The database must be migrated to exactly version: the schema is read from
+// it. The files of the squashed migrations are removed from MigrationsDir.
+//
+// Databases which already applied version skip the snapshot, and the older
+// versions it replaces stay in their migrations table without being
+// reported as missing. Fresh databases run the snapshot alone.
+func (m *Migrator) SquashContext(ctx context.Context, version string) error {
+	if m.Migrations[version] == nil {
+		return fmt.Errorf("migration %s is not registered", version)
+	}
+
+	return m.withLock(ctx, func() error {
+		if err := m.checkDirty(); err != nil {
+			return err
+		}
+
+		// The checksums recorded for version before the squash
+		original := m.Migrations[version]
+		checksums := slices.Clone(original.SquashedChecksums)
+		if original.Checksum != "" && !slices.Contains(checksums, original.Checksum) {
+			checksums = append(checksums, original.Checksum)
+		}
+
+		squashed := []string{}
+		for _, v := range m.Versions {
+			if v > version {
+				if m.applied(v) {
+					return fmt.Errorf("migration %s is applied, migrate the database to %s before squashing", v, version)
+				}
+				continue
+			}
+			if !m.applied(v) {
+				return fmt.Errorf("migration %s is pending, migrate the database to %s before squashing", v, version)
+			}
+			squashed = append(squashed, m.Migrations[v].Squashes...)
+			squashed = append(squashed, v)
+		}
+
+		objects, err := m.introspectSchema(ctx)
+		if err != nil {
+			return err
+		}
+
+		dir, err := makeMigrationsDir(m.MigrationsDir())
+		if err != nil {
+			return err
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		var b strings.Builder
+		fmt.Fprintln(&b, strings.TrimSpace(squashedDirective+" "+strings.Join(checksums, " ")))
+		// The snapshot itself keeps the squashed version
+		replaced := squashed[:len(squashed)-1]
+		for i := 0; i < len(replaced); i += 8 {
+			fmt.Fprintf(&b, "%s %s\n", squashesDirective, strings.Join(replaced[i:min(i+8, len(replaced))], " "))
+		}
+		fmt.Fprintf(&b, "-- Schema of the migrations up to %s\n\n", version)
+		b.WriteString(createStatements(objects))
+
+		files := map[Direction]string{
+			DirectionUp:   b.String(),
+			DirectionDown: m.dropStatements(objects),
+		}
+		for _, direction := range []Direction{DirectionUp, DirectionDown} {
+			fileName := filepath.Join(dir, fmt.Sprintf("%s_squashed.%s.sql", version, direction))
+			if err := os.WriteFile(fileName, []byte(files[direction]), 0o644); err != nil {
+				return fmt.Errorf("unable to write squashed migration: %w", err)
+			}
+			m.log().Info("Wrote squashed migration", "path", fileName)
+		}
+
+		for _, entry := range entries {
+			match := migrationFilePattern.FindStringSubmatch(entry.Name())
+			if match == nil || entry.IsDir() || match[1] > version {
+				continue
+			}
+			// Overwritten above rather than removed
+			if entry.Name() == version+"_squashed.up.sql" || entry.Name() == version+"_squashed.down.sql" {
+				continue
+			}
+
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+			m.log().Info("Removed squashed migration file", "path", filepath.Join(dir, entry.Name()))
+		}
+
+		return nil
+	})
+}
+
+// parseSquashesDirective returns the versions listed by the squashes
+// directives of a SQL migration
+func parseSquashesDirective(body string) []string {
+	versions := []string{}
+	for _, line := range strings.Split(body, "\n") {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), squashesDirective+" "); ok {
+			versions = append(versions, strings.Fields(rest)...)
+		}
+	}
+	return versions
+}
+
+// parseSquashedDirective reports whether a SQL migration is a snapshot,
+// and returns the checksums listed by its squashed directive
+func parseSquashedDirective(body string) (bool, []string) {
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == squashedDirective {
+			return true, nil
+		}
+		if rest, ok := strings.CutPrefix(line, squashedDirective+" "); ok {
+			return true, strings.Fields(rest)
+		}
+	}
+	return false, nil
+}
+
+// squashedVersions returns the versions replaced by a registered snapshot,
+// mapped to that snapshot
+func (m *Migrator) squashedVersions() map[string]*Migration {
+	squashed := map[string]*Migration{}
+	for _, mg := range m.Migrations {
+		for _, v := range mg.Squashes {
+			squashed[v] = mg
+		}
+	}
+	return squashed
+}
+
+// checkSquashes fails if one of the pending snapshots replaces applied
+// migrations: the database holds part of the snapshot's schema already
+func (m *Migrator) checkSquashes(pending []*Migration) error {
+	for _, mg := range pending {
+		for _, v := range mg.Squashes {
+			if m.applied(v) {
+				return fmt.Errorf("migration %s squashes %s which is already applied, apply the remaining squashed migrations with an older release first", mg.Version, v)
+			}
+		}
+	}
+	return nil
+}
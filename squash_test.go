@@ -0,0 +1,208 @@
+package migration
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSquash(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("MIGRATIONS_DIR", "migrations")
+
+	files := map[string]string{
+		"20240101000000_users.up.sql":   "CREATE TABLE users (id INTEGER);",
+		"20240101000000_users.down.sql": "DROP TABLE users;",
+		"20240102000000_posts.up.sql":   "CREATE TABLE posts (id INTEGER);\nCREATE INDEX posts_id ON posts (id);",
+		"20240102000000_posts.down.sql": "DROP TABLE posts;",
+		"20240103000000_tags.up.sql":    "CREATE TABLE tags (id INTEGER);",
+		"20240103000000_tags.down.sql":  "DROP TABLE tags;",
+	}
+	os.Mkdir("migrations", 0o755)
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join("migrations", name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Unable to write %s: %s", name, err)
+		}
+	}
+
+	m := newTestMigrator(t)
+	if err := m.AddSQLMigrationsDir("migrations"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if err := m.Squash("20240102000000"); err == nil {
+		t.Fatalf("Expected squashing a database which isn't migrated to fail")
+	}
+
+	if err := m.To("20240102000000"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if err := m.Squash("20240102000000"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	entries, _ := os.ReadDir("migrations")
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	expected := []string{
+		"20240102000000_squashed.down.sql",
+		"20240102000000_squashed.up.sql",
+		"20240103000000_tags.down.sql",
+		"20240103000000_tags.up.sql",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected files %v, got %v", expected, names)
+	}
+
+	// The database migrated before the squash skips the snapshot
+	squashed, err := New(m.db, DriverSQLite, WithLogger(NopLogger()))
+	if err != nil {
+		t.Fatalf("Unable to init migrator: %s", err)
+	}
+	if err := squashed.AddSQLMigrationsDir("migrations"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := squashed.Migrations["20240102000000"].Squashes; !reflect.DeepEqual(got, []string{"20240101000000"}) {
+		t.Errorf("Expected the snapshot to squash 20240101000000, got %v", got)
+	}
+	if err := squashed.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if err := squashed.Validate(); err != nil {
+		t.Errorf("Expected squashed versions to be valid, got %s", err)
+	}
+
+	// A fresh database runs the snapshot alone
+	fresh := newTestMigrator(t)
+	if err := fresh.AddSQLMigrationsDir("migrations"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if err := fresh.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, fresh.db); !reflect.DeepEqual(got, []string{"20240102000000", "20240103000000"}) {
+		t.Errorf("Expected the snapshot and tags to be applied, got %v", got)
+	}
+	var index string
+	if err := fresh.db.QueryRow("SELECT sql FROM sqlite_master WHERE name = 'posts_id'").Scan(&index); err != nil || !strings.Contains(index, "posts") {
+		t.Errorf("Expected the snapshot to create the index, got %q, %v", index, err)
+	}
+
+	// Reverting the snapshot forgets the versions it squashes
+	if err := squashed.Reset(); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, squashed.db); len(got) != 0 {
+		t.Errorf("Expected no applied versions, got %v", got)
+	}
+}
+
+func TestUpRefusesSnapshotOverPartiallyMigratedDatabase(t *testing.T) {
+	m := newTestMigrator(t, createTableMigration("20240101000000", "users"))
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	snapshot := createTableMigration("20240102000000", "posts")
+	snapshot.Squashes = []string{"20240101000000"}
+	m.AddMigration(snapshot)
+
+	if err := m.Up(0); err == nil || !strings.Contains(err.Error(), "squashes 20240101000000") {
+		t.Fatalf("Expected the snapshot to be refused, got %v", err)
+	}
+}
+
+func TestRepairKeepsSquashedVersions(t *testing.T) {
+	m := newTestMigrator(t, createTableMigration("20240101000000", "users"))
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	// The squashed migration is no longer registered, only its snapshot
+	snapshot := createTableMigration("20240102000000", "users")
+	snapshot.Squashes = []string{"20240101000000"}
+	r := NewRegistry()
+	r.AddMigration(snapshot)
+	squashed, err := New(m.db, DriverSQLite, WithRegistry(r), WithLogger(NopLogger()))
+	if err != nil {
+		t.Fatalf("Unable to init migrator: %s", err)
+	}
+
+	if err := squashed.Up(0); err == nil || !strings.Contains(err.Error(), "squashes 20240101000000") {
+		t.Fatalf("Expected the snapshot to be refused, got %v", err)
+	}
+	if err := squashed.Repair(); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if got := appliedVersions(t, m.db); !reflect.DeepEqual(got, []string{"20240101000000"}) {
+		t.Errorf("Expected the squashed version to be kept, got %v", got)
+	}
+	if err := squashed.Up(0); err == nil || !strings.Contains(err.Error(), "squashes 20240101000000") {
+		t.Errorf("Expected the snapshot to still be refused, got %v", err)
+	}
+}
+
+func TestSquashSingleMigration(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("MIGRATIONS_DIR", "migrations")
+
+	os.Mkdir("migrations", 0o755)
+	os.WriteFile(filepath.Join("migrations", "20240101000000_users.up.sql"), []byte("CREATE TABLE users (id INTEGER);"), 0o644)
+	os.WriteFile(filepath.Join("migrations", "20240101000000_users.down.sql"), []byte("DROP TABLE users;"), 0o644)
+
+	m := newTestMigrator(t)
+	if err := m.AddSQLMigrationsDir("migrations"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if err := m.Squash("20240101000000"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	// The database migrated before the squash recorded the original checksum
+	squashed, err := New(m.db, DriverSQLite, WithLogger(NopLogger()))
+	if err != nil {
+		t.Fatalf("Unable to init migrator: %s", err)
+	}
+	if err := squashed.AddSQLMigrationsDir("migrations"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if snapshot := squashed.Migrations["20240101000000"]; !snapshot.Snapshot || len(snapshot.Squashes) != 0 {
+		t.Errorf("Expected a snapshot squashing no older version, got %+v", snapshot)
+	}
+	if err := squashed.Validate(); err != nil {
+		t.Errorf("Expected the database migrated before the squash to be valid, got %s", err)
+	}
+
+	// A database which ran the snapshot notices changes to it
+	fresh := newTestMigrator(t)
+	if err := fresh.AddSQLMigrationsDir("migrations"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	if err := fresh.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	path := filepath.Join("migrations", "20240101000000_squashed.up.sql")
+	content, _ := os.ReadFile(path)
+	os.WriteFile(path, append(content, "CREATE TABLE extra (id INTEGER);\n"...), 0o644)
+
+	edited, err := New(fresh.db, DriverSQLite, WithLogger(NopLogger()))
+	if err != nil {
+		t.Fatalf("Unable to init migrator: %s", err)
+	}
+	if err := edited.AddSQLMigrationsDir("migrations"); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	var validationErr *ValidationError
+	if err := edited.Validate(); !errors.As(err, &validationErr) || validationErr.Issues[0].Problem != ProblemChecksumMismatch {
+		t.Errorf("Expected a checksum mismatch, got %v", err)
+	}
+}
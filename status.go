@@ -0,0 +1,63 @@
+package migration
+
+import (
+	"context"
+	"time"
+)
+
+// MigrationState describes a registered migration and whether it was applied
+type MigrationState struct {
+	Version string `json:"version" yaml:"version"`
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	Applied bool   `json:"applied" yaml:"applied"`
+	// OutOfOrder marks a pending migration older than the newest applied one
+	OutOfOrder bool `json:"out_of_order,omitempty" yaml:"out_of_order,omitempty"`
+	// Dirty marks a migration whose run was interrupted halfway
+	Dirty bool `json:"dirty,omitempty" yaml:"dirty,omitempty"`
+	// Skipped marks a pending migration not meant for the environment
+	Skipped bool `json:"skipped,omitempty" yaml:"skipped,omitempty"`
+
+	// The fields below are only set for applied migrations, and may be
+	// missing for migrations applied by older versions
+	Batch       int        `json:"batch,omitempty" yaml:"batch,omitempty"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty" yaml:"applied_at,omitempty"`
+	AppliedBy   string     `json:"applied_by,omitempty" yaml:"applied_by,omitempty"`
+	ExecutionMs int64      `json:"execution_ms,omitempty" yaml:"execution_ms,omitempty"`
+}
+
+// MigrationStatus returns the state of every registered migration, in
+// version order
+func (m *Migrator) MigrationStatus() ([]MigrationState, error) {
+	return m.MigrationStatusContext(context.Background())
+}
+
+// MigrationStatusContext is like MigrationStatus but takes a context
+func (m *Migrator) MigrationStatusContext(ctx context.Context) ([]MigrationState, error) {
+	if err := m.loadApplied(ctx); err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(m.Versions))
+	for _, v := range m.Versions {
+		state := MigrationState{Version: v, Name: m.Migrations[v].Name}
+
+		if record := m.history[v]; record != nil {
+			state.Applied = true
+			state.Dirty = record.dirty != ""
+			state.Batch = record.batch
+			state.AppliedBy = record.appliedBy
+			state.ExecutionMs = record.executionMs
+			if !record.appliedAt.IsZero() {
+				appliedAt := record.appliedAt
+				state.AppliedAt = &appliedAt
+			}
+		} else {
+			state.OutOfOrder = m.outOfOrder(v)
+			state.Skipped = !m.runsHere(m.Migrations[v])
+		}
+
+		states = append(states, state)
+	}
+
+	return states, nil
+}
@@ -0,0 +1,35 @@
+package migration
+
+import "testing"
+
+func TestMigrationStatus(t *testing.T) {
+	users := createTableMigration("20240102000000", "users")
+	users.Name = "create_users"
+	m := newTestMigrator(t, users, createTableMigration("20240103000000", "posts"))
+
+	if err := m.Up(1); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+	m.AddMigration(createTableMigration("20240101000000", "tags"))
+
+	states, err := m.MigrationStatus()
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if len(states) != 3 {
+		t.Fatalf("Expected 3 states, got %v", states)
+	}
+
+	if s := states[0]; s.Version != "20240101000000" || s.Applied || !s.OutOfOrder {
+		t.Errorf("Expected 20240101000000 to be pending out of order, got %+v", s)
+	}
+
+	if s := states[1]; s.Version != "20240102000000" || s.Name != "create_users" || !s.Applied || s.Batch != 1 || s.AppliedAt == nil || s.AppliedBy == "" {
+		t.Errorf("Expected 20240102000000 to be applied in batch 1, got %+v", s)
+	}
+
+	if s := states[2]; s.Version != "20240103000000" || s.Applied || s.OutOfOrder || s.AppliedAt != nil {
+		t.Errorf("Expected 20240103000000 to be pending, got %+v", s)
+	}
+}
@@ -0,0 +1,104 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// ValidationProblem tells why an applied migration failed validation
+type ValidationProblem string
+
+const (
+	// ProblemChecksumMismatch means the migration was edited after it was applied
+	ProblemChecksumMismatch ValidationProblem = "checksum mismatch"
+	// ProblemMissing means the migration was applied but is no longer registered
+	ProblemMissing ValidationProblem = "missing"
+)
+
+// ValidationIssue describes an applied migration that no longer matches the code
+type ValidationIssue struct {
+	Version string
+	Problem ValidationProblem
+	// AppliedChecksum is the checksum stored when the migration was applied
+	AppliedChecksum string
+	// CurrentChecksum is the checksum of the registered migration
+	CurrentChecksum string
+}
+
+func (i ValidationIssue) String() string {
+	if i.Problem == ProblemChecksumMismatch {
+		return fmt.Sprintf("migration %s: %s (applied %s, current %s)", i.Version, i.Problem, i.AppliedChecksum, i.CurrentChecksum)
+	}
+	return fmt.Sprintf("migration %s: %s", i.Version, i.Problem)
+}
+
+// ValidationError lists every applied migration that failed validation
+type ValidationError struct {
+	Issues []ValidationIssue
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		lines[i] = issue.String()
+	}
+	return fmt.Sprintf("%d applied migration(s) failed validation:\n%s", len(e.Issues), strings.Join(lines, "\n"))
+}
+
+// Validate checks every applied migration against the registered ones, and
+// returns a *ValidationError listing those whose checksum has changed or
+// that are no longer registered. Migrations applied without a checksum are
+// not compared, nor are the versions replaced by a snapshot. Databases
+// migrated before a squash may hold the checksum of the migration the
+// snapshot replaced, see Migration.SquashedChecksums.
+func (m *Migrator) Validate() error {
+	return m.ValidateContext(context.Background())
+}
+
+// ValidateContext is like Validate but takes a context
+func (m *Migrator) ValidateContext(ctx context.Context) error {
+	rows, err := m.db.QueryContext(ctx, "SELECT version, checksum FROM "+m.table()+" ORDER BY version;")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	squashed := m.squashedVersions()
+	issues := []ValidationIssue{}
+	for rows.Next() {
+		var version string
+		var applied sql.NullString
+		if err := rows.Scan(&version, &applied); err != nil {
+			return err
+		}
+
+		mg := m.Migrations[version]
+		if mg == nil && squashed[version] != nil {
+			continue
+		}
+		if mg == nil {
+			issues = append(issues, ValidationIssue{Version: version, Problem: ProblemMissing, AppliedChecksum: applied.String})
+			continue
+		}
+
+		if applied.String != "" && !mg.matchesChecksum(applied.String) {
+			issues = append(issues, ValidationIssue{
+				Version:         version,
+				Problem:         ProblemChecksumMismatch,
+				AppliedChecksum: applied.String,
+				CurrentChecksum: mg.Checksum,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(issues) > 0 {
+		return &ValidationError{Issues: issues}
+	}
+
+	return nil
+}
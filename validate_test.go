@@ -0,0 +1,76 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestValidateReportsChangedAndMissingMigrations(t *testing.T) {
+	users := createTableMigration("20240101000000", "users")
+	users.Checksum = "v1"
+	posts := createTableMigration("20240102000000", "posts")
+	posts.Checksum = "v1"
+	unchecked := createTableMigration("20240103000000", "tags")
+
+	m := newTestMigrator(t, users, posts, unchecked)
+	if err := m.Up(0); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	if err := m.Validate(); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	// Edit one migration and remove another
+	users.Checksum = "v2"
+	delete(m.Migrations, posts.Version)
+
+	var validationErr *ValidationError
+	if err := m.Validate(); !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+
+	expected := []ValidationIssue{
+		{Version: "20240101000000", Problem: ProblemChecksumMismatch, AppliedChecksum: "v1", CurrentChecksum: "v2"},
+		{Version: "20240102000000", Problem: ProblemMissing, AppliedChecksum: "v1"},
+	}
+	if !reflect.DeepEqual(validationErr.Issues, expected) {
+		t.Errorf("\nExpected:\n%v\nGot:\n%v", expected, validationErr.Issues)
+	}
+}
+
+func TestSQLMigrationChecksumIsHashOfUpFile(t *testing.T) {
+	m := newTestMigrator(t)
+
+	fsys := fstest.MapFS{
+		"20240101000000_create_users.up.sql": {Data: []byte("CREATE TABLE users (id INTEGER);")},
+	}
+	if err := m.AddSQLMigrations(fsys, "."); err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	expected := checksum("CREATE TABLE users (id INTEGER);")
+	if got := m.Migrations["20240101000000"].Checksum; got != expected {
+		t.Errorf("Expected checksum %s, got %s", expected, got)
+	}
+}
+
+func TestEnsureTableUpgradesLegacyTable(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec("CREATE TABLE schema_migrations (version varchar(255), batch int); INSERT INTO schema_migrations VALUES ('20240101000000', 1);"); err != nil {
+		t.Fatalf("Unable to create legacy table: %s", err)
+	}
+
+	m, err := New(db, DriverSQLite)
+	if err != nil {
+		t.Fatalf("Expected error to be nil, got %s", err)
+	}
+
+	// The legacy row has no checksum and is reported as missing only
+	var validationErr *ValidationError
+	if err := m.Validate(); !errors.As(err, &validationErr) || len(validationErr.Issues) != 1 || validationErr.Issues[0].Problem != ProblemMissing {
+		t.Errorf("Expected a single missing migration, got %v", err)
+	}
+}